@@ -11,6 +11,8 @@ import (
 type Node interface {
 	TokenLiteral() string
 	String() string
+	Pos() token.Position // position of the first character belonging to the node
+	End() token.Position // position immediately after the node
 }
 
 // Statement :
@@ -30,6 +32,7 @@ type Expression interface {
 // Program : root node of AST
 type Program struct {
 	Statements []Statement
+	Comments   []*Comment // all comments in source order (only when the lexer scans comments)
 }
 
 func (p *Program) TokenLiteral() string {
@@ -40,6 +43,20 @@ func (p *Program) TokenLiteral() string {
 	}
 }
 
+func (p *Program) Pos() token.Position {
+	if len(p.Statements) > 0 {
+		return p.Statements[0].Pos()
+	}
+	return token.Position{}
+}
+
+func (p *Program) End() token.Position {
+	if n := len(p.Statements); n > 0 {
+		return p.Statements[n-1].End()
+	}
+	return token.Position{}
+}
+
 func (p *Program) String() string {
 	var out bytes.Buffer
 
@@ -52,20 +69,47 @@ func (p *Program) String() string {
 
 /*---------------------------------------------------------------------------*/
 
-// LetStatement : let <identifier> = <expression>
+// Comment : "// ..." or "/* ... */"
+type Comment struct {
+	Token token.Token // token.COMMENT
+}
+
+// TokenLiteral : return token literal
+func (c *Comment) TokenLiteral() string { return c.Token.Literal }
+func (c *Comment) String() string       { return c.Token.Literal }
+func (c *Comment) Pos() token.Position  { return c.Token.Pos }
+func (c *Comment) End() token.Position  { return c.Token.End }
+
+/*---------------------------------------------------------------------------*/
+
+// LetStatement : let <identifier> = <expression> または const <identifier> = <expression>
 type LetStatement struct {
-	Token token.Token // token.LET
-	Name  *Identifier
-	Value Expression
+	Token    token.Token // token.LET or token.CONST
+	Name     *Identifier
+	Value    Expression
+	Comments []*Comment // 直前と行末のコメント
 }
 
 func (ls *LetStatement) statementNode() {}
 
+// IsConst : report whether the statement is a const declaration
+func (ls *LetStatement) IsConst() bool {
+	return ls.Token.Type == token.CONST
+}
+
 // TokenLiteral : return token literal
 func (ls *LetStatement) TokenLiteral() string {
 	return ls.Token.Literal
 }
 
+func (ls *LetStatement) Pos() token.Position { return ls.Token.Pos }
+func (ls *LetStatement) End() token.Position {
+	if ls.Value != nil {
+		return ls.Value.End()
+	}
+	return ls.Name.End()
+}
+
 func (ls *LetStatement) String() string {
 	var out bytes.Buffer
 
@@ -84,10 +128,47 @@ func (ls *LetStatement) String() string {
 
 /*---------------------------------------------------------------------------*/
 
+// FunctionStatement : fn <name>(<parameters>) <block>
+//
+// 関数をその名前で現在のスコープに束縛する
+type FunctionStatement struct {
+	Function *FunctionLiteral
+	Comments []*Comment // 直前と行末のコメント
+}
+
+func (fs *FunctionStatement) statementNode()       {}
+func (fs *FunctionStatement) TokenLiteral() string { return fs.Function.TokenLiteral() }
+func (fs *FunctionStatement) Pos() token.Position  { return fs.Function.Pos() }
+func (fs *FunctionStatement) End() token.Position  { return fs.Function.End() }
+func (fs *FunctionStatement) String() string       { return fs.Function.String() }
+
+/*---------------------------------------------------------------------------*/
+
+// StaticStatement : クラスの本体の static let / static const / static fn
+//
+// インスタンスごとではなく、クラスを定義したときに一度だけ評価する
+// static の前のコメントは Comments に、行末のコメントは Statement に付く
+type StaticStatement struct {
+	Token     token.Token // 'static' トークン
+	Statement Statement
+	Comments  []*Comment // 直前のコメント
+}
+
+func (ss *StaticStatement) statementNode()       {}
+func (ss *StaticStatement) TokenLiteral() string { return ss.Token.Literal }
+func (ss *StaticStatement) Pos() token.Position  { return ss.Token.Pos }
+func (ss *StaticStatement) End() token.Position  { return ss.Statement.End() }
+func (ss *StaticStatement) String() string {
+	return ss.TokenLiteral() + " " + ss.Statement.String()
+}
+
+/*---------------------------------------------------------------------------*/
+
 // ReturnStatement : return <expression>
 type ReturnStatement struct {
 	Token       token.Token // 'return' トークン
 	ReturnValue Expression
+	Comments    []*Comment // 直前と行末のコメント
 }
 
 func (rs *ReturnStatement) statementNode() {}
@@ -97,6 +178,14 @@ func (rs *ReturnStatement) TokenLiteral() string {
 	return rs.Token.Literal
 }
 
+func (rs *ReturnStatement) Pos() token.Position { return rs.Token.Pos }
+func (rs *ReturnStatement) End() token.Position {
+	if rs.ReturnValue != nil {
+		return rs.ReturnValue.End()
+	}
+	return rs.Token.End
+}
+
 func (rs *ReturnStatement) String() string {
 	var out bytes.Buffer
 
@@ -114,6 +203,7 @@ func (rs *ReturnStatement) String() string {
 type ExpressionStatement struct {
 	Token      token.Token // 式の最初のトークン
 	Expression Expression
+	Comments   []*Comment // 直前と行末のコメント
 }
 
 func (es *ExpressionStatement) statementNode() {}
@@ -122,6 +212,14 @@ func (es *ExpressionStatement) TokenLiteral() string {
 	return es.Token.Literal
 }
 
+func (es *ExpressionStatement) Pos() token.Position { return es.Token.Pos }
+func (es *ExpressionStatement) End() token.Position {
+	if es.Expression != nil {
+		return es.Expression.End()
+	}
+	return es.Token.End
+}
+
 func (es *ExpressionStatement) String() string {
 	if es.Expression != nil {
 		return es.Expression.String()
@@ -145,6 +243,9 @@ func (i *Identifier) TokenLiteral() string {
 	return i.Token.Literal
 }
 
+func (i *Identifier) Pos() token.Position { return i.Token.Pos }
+func (i *Identifier) End() token.Position { return i.Token.End }
+
 func (i *Identifier) String() string {
 	return i.Value
 }
@@ -162,12 +263,28 @@ func (il *IntegerLiteral) TokenLiteral() string {
 	return il.Token.Literal
 }
 
+func (il *IntegerLiteral) Pos() token.Position { return il.Token.Pos }
+func (il *IntegerLiteral) End() token.Position { return il.Token.End }
+
 func (il *IntegerLiteral) String() string {
 	return il.Token.Literal
 }
 
 /*---------------------------------------------------------------------------*/
 
+type FloatLiteral struct {
+	Token token.Token
+	Value float64
+}
+
+func (fl *FloatLiteral) expressionNode()      {}
+func (fl *FloatLiteral) TokenLiteral() string { return fl.Token.Literal }
+func (fl *FloatLiteral) Pos() token.Position  { return fl.Token.Pos }
+func (fl *FloatLiteral) End() token.Position  { return fl.Token.End }
+func (fl *FloatLiteral) String() string       { return fl.Token.Literal }
+
+/*---------------------------------------------------------------------------*/
+
 type StringLiteral struct {
 	Token token.Token
 	Value string
@@ -175,10 +292,47 @@ type StringLiteral struct {
 
 func (sl *StringLiteral) expressionNode()      {}
 func (sl *StringLiteral) TokenLiteral() string { return sl.Token.Literal }
+func (sl *StringLiteral) Pos() token.Position  { return sl.Token.Pos }
+func (sl *StringLiteral) End() token.Position  { return sl.Token.End }
 func (sl *StringLiteral) String() string       { return sl.Token.Literal }
 
 /*---------------------------------------------------------------------------*/
 
+// TemplateLiteral : 式を埋め込んだ文字列 "Hello ${name}!"
+// Texts は埋め込み式の前後の文字列で、常に len(Texts) == len(Values)+1
+type TemplateLiteral struct {
+	Token  token.Token // TEMPLATE_HEAD トークン
+	Texts  []string
+	Values []Expression
+	Tail   token.Token // TEMPLATE_TAIL トークン
+}
+
+func (tl *TemplateLiteral) expressionNode()      {}
+func (tl *TemplateLiteral) TokenLiteral() string { return tl.Token.Literal }
+func (tl *TemplateLiteral) Pos() token.Position  { return tl.Token.Pos }
+func (tl *TemplateLiteral) End() token.Position {
+	if !tl.Tail.End.IsValid() {
+		return tl.Token.End
+	}
+	return tl.Tail.End
+}
+func (tl *TemplateLiteral) String() string {
+	var out bytes.Buffer
+
+	for i, text := range tl.Texts {
+		out.WriteString(text)
+		if i < len(tl.Values) {
+			out.WriteString("${")
+			out.WriteString(tl.Values[i].String())
+			out.WriteString("}")
+		}
+	}
+
+	return out.String()
+}
+
+/*---------------------------------------------------------------------------*/
+
 type Boolean struct {
 	Token token.Token
 	Value bool
@@ -186,6 +340,8 @@ type Boolean struct {
 
 func (b *Boolean) expressionNode()      {}
 func (b *Boolean) TokenLiteral() string { return b.Token.Literal }
+func (b *Boolean) Pos() token.Position  { return b.Token.Pos }
+func (b *Boolean) End() token.Position  { return b.Token.End }
 func (b *Boolean) String() string       { return b.Token.Literal }
 
 /*---------------------------------------------------------------------------*/
@@ -193,10 +349,13 @@ func (b *Boolean) String() string       { return b.Token.Literal }
 type ArrayLiteral struct {
 	Token    token.Token // '[' トークン
 	Elements []Expression
+	Rbracket token.Position // ']' の位置
 }
 
 func (al *ArrayLiteral) expressionNode()      {}
 func (al *ArrayLiteral) TokenLiteral() string { return al.Token.Literal }
+func (al *ArrayLiteral) Pos() token.Position  { return al.Token.Pos }
+func (al *ArrayLiteral) End() token.Position  { return endAfter(al.Rbracket, al.Token.End) }
 func (al *ArrayLiteral) String() string {
 	var out bytes.Buffer
 
@@ -222,6 +381,13 @@ type PrefixExpression struct {
 
 func (pe *PrefixExpression) expressionNode()      {}
 func (pe *PrefixExpression) TokenLiteral() string { return pe.Token.Literal }
+func (pe *PrefixExpression) Pos() token.Position  { return pe.Token.Pos }
+func (pe *PrefixExpression) End() token.Position {
+	if pe.Right != nil {
+		return pe.Right.End()
+	}
+	return pe.Token.End
+}
 func (pe *PrefixExpression) String() string {
 	var out bytes.Buffer
 	out.WriteString("(")
@@ -242,6 +408,13 @@ type InfixExpression struct {
 
 func (oe *InfixExpression) expressionNode()      {}
 func (oe *InfixExpression) TokenLiteral() string { return oe.Token.Literal }
+func (oe *InfixExpression) Pos() token.Position  { return oe.Left.Pos() }
+func (oe *InfixExpression) End() token.Position {
+	if oe.Right != nil {
+		return oe.Right.End()
+	}
+	return oe.Token.End
+}
 func (oe *InfixExpression) String() string {
 	var out bytes.Buffer
 
@@ -265,6 +438,13 @@ type IfExpression struct {
 
 func (ie *IfExpression) expressionNode()      {}
 func (ie *IfExpression) TokenLiteral() string { return ie.Token.Literal }
+func (ie *IfExpression) Pos() token.Position  { return ie.Token.Pos }
+func (ie *IfExpression) End() token.Position {
+	if ie.Alternative != nil {
+		return ie.Alternative.End()
+	}
+	return ie.Consequence.End()
+}
 func (ie *IfExpression) String() string {
 	var out bytes.Buffer
 
@@ -284,12 +464,15 @@ func (ie *IfExpression) String() string {
 /*---------------------------------------------------------------------------*/
 
 type BlockStatement struct {
-	Token      token.Token
+	Token      token.Token // '{' トークン
 	Statements []Statement
+	Rbrace     token.Position // '}' の位置
 }
 
 func (bs *BlockStatement) statementNode()       {}
 func (bs *BlockStatement) TokenLiteral() string { return bs.Token.Literal }
+func (bs *BlockStatement) Pos() token.Position  { return bs.Token.Pos }
+func (bs *BlockStatement) End() token.Position  { return endAfter(bs.Rbrace, bs.Token.End) }
 func (bs *BlockStatement) String() string {
 	var out bytes.Buffer
 
@@ -304,29 +487,65 @@ func (bs *BlockStatement) String() string {
 
 type FunctionLiteral struct {
 	Token      token.Token
+	Name       string // fn name() {} の名前、let f = fn() {} では束縛先の名前、無名関数なら空
+	Inferred   bool   // Name を let の束縛先から付けた (関数の本体からその名前では呼び出せない)
 	Parameters []*Identifier
+	Defaults   []Expression // Parameters と同じ長さ、デフォルト値の無い引数は nil
+	Rest       *Identifier  // 残余引数 (...rest)、無ければ nil
 	Body       *BlockStatement
 }
 
 func (fl *FunctionLiteral) expressionNode()      {}
 func (fl *FunctionLiteral) TokenLiteral() string { return fl.Token.Literal }
+func (fl *FunctionLiteral) Pos() token.Position  { return fl.Token.Pos }
+func (fl *FunctionLiteral) End() token.Position  { return fl.Body.End() }
 func (fl *FunctionLiteral) String() string {
 	var out bytes.Buffer
 
-	params := []string{}
-	for _, p := range fl.Parameters {
-		params = append(params, p.String())
-	}
-
 	out.WriteString(fl.TokenLiteral())
+	if fl.Name != "" && !fl.Inferred {
+		out.WriteString(" " + fl.Name)
+	}
 	out.WriteString("(")
-	out.WriteString(strings.Join(params, ", "))
+	out.WriteString(ParametersString(fl.Parameters, fl.Defaults, fl.Rest))
 	out.WriteString(")")
 	out.WriteString(fl.Body.String())
 
 	return out.String()
 }
 
+// ParametersString : 引数リストを "a, b = 2, ...rest" の形式で文字列にする
+func ParametersString(params []*Identifier, defaults []Expression, rest *Identifier) string {
+	list := []string{}
+	for i, p := range params {
+		if defaults != nil && defaults[i] != nil {
+			list = append(list, p.String()+" = "+defaults[i].String())
+		} else {
+			list = append(list, p.String())
+		}
+	}
+	if rest != nil {
+		list = append(list, "..."+rest.String())
+	}
+	return strings.Join(list, ", ")
+}
+
+/*---------------------------------------------------------------------------*/
+
+// SpreadExpression : 呼び出し引数や配列リテラルの中で配列を展開する (...arr)
+type SpreadExpression struct {
+	Token token.Token // '...' トークン
+	Value Expression
+}
+
+func (se *SpreadExpression) expressionNode()      {}
+func (se *SpreadExpression) TokenLiteral() string { return se.Token.Literal }
+func (se *SpreadExpression) Pos() token.Position  { return se.Token.Pos }
+func (se *SpreadExpression) End() token.Position  { return se.Value.End() }
+func (se *SpreadExpression) String() string {
+	return "..." + se.Value.String()
+}
+
 /*---------------------------------------------------------------------------*/
 
 type MacroLiteral struct {
@@ -337,6 +556,8 @@ type MacroLiteral struct {
 
 func (ml *MacroLiteral) expressionNode()      {}
 func (ml *MacroLiteral) TokenLiteral() string { return ml.Token.Literal }
+func (ml *MacroLiteral) Pos() token.Position  { return ml.Token.Pos }
+func (ml *MacroLiteral) End() token.Position  { return ml.Body.End() }
 func (ml *MacroLiteral) String() string {
 	var out bytes.Buffer
 
@@ -360,10 +581,14 @@ type CallExpression struct {
 	Token     token.Token // '(' token
 	Function  Expression  // Identifier or FunctionLiteral
 	Arguments []Expression
+	Rparen    token.Position // position of ')'
+	Tail      bool           // 関数の末尾位置にある呼び出し (MarkTailCalls を参照)
 }
 
 func (ce *CallExpression) expressionNode()      {}
 func (ce *CallExpression) TokenLiteral() string { return ce.Token.Literal }
+func (ce *CallExpression) Pos() token.Position  { return ce.Function.Pos() }
+func (ce *CallExpression) End() token.Position  { return endAfter(ce.Rparen, ce.Token.End) }
 func (ce *CallExpression) String() string {
 	var out bytes.Buffer
 
@@ -383,13 +608,16 @@ func (ce *CallExpression) String() string {
 /*---------------------------------------------------------------------------*/
 
 type IndexExpression struct {
-	Token token.Token // '[' トークン
-	Left  Expression
-	Index Expression
+	Token    token.Token // '[' トークン
+	Left     Expression
+	Index    Expression
+	Rbracket token.Position // ']' の位置
 }
 
 func (ie *IndexExpression) expressionNode()      {}
 func (ie *IndexExpression) TokenLiteral() string { return ie.Token.Literal }
+func (ie *IndexExpression) Pos() token.Position  { return ie.Left.Pos() }
+func (ie *IndexExpression) End() token.Position  { return endAfter(ie.Rbracket, ie.Token.End) }
 func (ie *IndexExpression) String() string {
 	var out bytes.Buffer
 
@@ -405,12 +633,15 @@ func (ie *IndexExpression) String() string {
 /*---------------------------------------------------------------------------*/
 
 type HashLiteral struct {
-	Token token.Token // '{' トークン
-	Pairs map[Expression]Expression
+	Token  token.Token // '{' トークン
+	Pairs  map[Expression]Expression
+	Rbrace token.Position // '}' の位置
 }
 
 func (hl *HashLiteral) expressionNode()      {}
 func (hl *HashLiteral) TokenLiteral() string { return hl.Token.Literal }
+func (hl *HashLiteral) Pos() token.Position  { return hl.Token.Pos }
+func (hl *HashLiteral) End() token.Position  { return endAfter(hl.Rbrace, hl.Token.End) }
 func (hl *HashLiteral) String() string {
 	var out bytes.Buffer
 
@@ -429,17 +660,24 @@ func (hl *HashLiteral) String() string {
 /*---------------------------------------------------------------------------*/
 
 type ClassLiteral struct {
-	Token token.Token
-	Body  *BlockStatement
-	Name  *Identifier
+	Token  token.Token
+	Body   *BlockStatement
+	Name   *Identifier
+	Parent Expression // extends の後の式、継承しなければ nil
 }
 
 func (cl *ClassLiteral) expressionNode()      {}
 func (cl *ClassLiteral) TokenLiteral() string { return cl.Token.Literal }
+func (cl *ClassLiteral) Pos() token.Position  { return cl.Token.Pos }
+func (cl *ClassLiteral) End() token.Position  { return cl.Body.End() }
 func (cl *ClassLiteral) String() string {
 	var out bytes.Buffer
 
 	out.WriteString(cl.TokenLiteral())
+	out.WriteString(" " + cl.Name.String() + " ")
+	if cl.Parent != nil {
+		out.WriteString("extends " + cl.Parent.String() + " ")
+	}
 	out.WriteString(cl.Body.String())
 
 	return out.String()
@@ -455,6 +693,8 @@ type DotExpression struct {
 
 func (de *DotExpression) expressionNode()      {}
 func (de *DotExpression) TokenLiteral() string { return de.Token.Literal }
+func (de *DotExpression) Pos() token.Position  { return de.Left.Pos() }
+func (de *DotExpression) End() token.Position  { return de.Right.End() }
 func (de *DotExpression) String() string {
 	var out bytes.Buffer
 
@@ -462,6 +702,7 @@ func (de *DotExpression) String() string {
 	out.WriteString(de.Left.String())
 	out.WriteString(".")
 	out.WriteString(de.Right.String())
+	out.WriteString(")")
 
 	return out.String()
 }
@@ -475,26 +716,213 @@ type This struct {
 
 func (t *This) expressionNode()      {}
 func (t *This) TokenLiteral() string { return t.Token.Literal }
+func (t *This) Pos() token.Position  { return t.Token.Pos }
+func (t *This) End() token.Position  { return t.Token.End }
 func (t *This) String() string       { return t.Value }
 
 /*---------------------------------------------------------------------------*/
 
+// Super : 親クラスのコンストラクタ呼び出し super(...) やメンバ参照 super.method
+type Super struct {
+	Token token.Token // token.SUPER
+}
+
+func (s *Super) expressionNode()      {}
+func (s *Super) TokenLiteral() string { return s.Token.Literal }
+func (s *Super) Pos() token.Position  { return s.Token.Pos }
+func (s *Super) End() token.Position  { return s.Token.End }
+func (s *Super) String() string       { return s.Token.Literal }
+
+/*---------------------------------------------------------------------------*/
+
 type AssignmentExpression struct {
-	Token token.Token
-	Left  Expression // 左辺がドット演算子を含む式になっているかもしれないため、Expression を使う
-	Right Expression // Expression
+	Token    token.Token
+	Left     Expression // 左辺がドット演算子を含む式になっているかもしれないため、Expression を使う
+	Operator string     // "=", "+=", "-=", "*=", "/="
+	Right    Expression // Expression
 }
 
 func (ae *AssignmentExpression) expressionNode()      {}
 func (ae *AssignmentExpression) TokenLiteral() string { return ae.Token.Literal }
+func (ae *AssignmentExpression) Pos() token.Position  { return ae.Left.Pos() }
+func (ae *AssignmentExpression) End() token.Position {
+	if ae.Right != nil {
+		return ae.Right.End()
+	}
+	return ae.Token.End
+}
 func (ae *AssignmentExpression) String() string {
 	var out bytes.Buffer
 
 	out.WriteString("(")
 	out.WriteString(ae.Left.String())
-	out.WriteString("=")
+	out.WriteString(ae.Operator)
 	out.WriteString(ae.Right.String())
 	out.WriteString(")")
 
 	return out.String()
 }
+
+/*---------------------------------------------------------------------------*/
+
+// WhileStatement : while (<condition>) { <body> }
+type WhileStatement struct {
+	Token     token.Token // 'while' トークン
+	Condition Expression
+	Body      *BlockStatement
+	Comments  []*Comment // 直前と行末のコメント
+}
+
+func (ws *WhileStatement) statementNode()       {}
+func (ws *WhileStatement) TokenLiteral() string { return ws.Token.Literal }
+func (ws *WhileStatement) Pos() token.Position  { return ws.Token.Pos }
+func (ws *WhileStatement) End() token.Position  { return ws.Body.End() }
+func (ws *WhileStatement) String() string {
+	var out bytes.Buffer
+
+	out.WriteString("while")
+	out.WriteString(ws.Condition.String())
+	out.WriteString(" ")
+	out.WriteString(ws.Body.String())
+
+	return out.String()
+}
+
+/*---------------------------------------------------------------------------*/
+
+// ForStatement : for (<value> in <iterable>) { <body> }
+//
+// for (<key>, <value> in <iterable>) の形式では、Key に配列の添字やハッシュのキーが入る
+type ForStatement struct {
+	Token    token.Token // 'for' トークン
+	Key      *Identifier // 省略された場合は nil
+	Value    *Identifier
+	Iterable Expression
+	Body     *BlockStatement
+	Comments []*Comment // 直前と行末のコメント
+}
+
+func (fs *ForStatement) statementNode()       {}
+func (fs *ForStatement) TokenLiteral() string { return fs.Token.Literal }
+func (fs *ForStatement) Pos() token.Position  { return fs.Token.Pos }
+func (fs *ForStatement) End() token.Position  { return fs.Body.End() }
+func (fs *ForStatement) String() string {
+	var out bytes.Buffer
+
+	out.WriteString("for (")
+	if fs.Key != nil {
+		out.WriteString(fs.Key.String())
+		out.WriteString(", ")
+	}
+	out.WriteString(fs.Value.String())
+	out.WriteString(" in ")
+	out.WriteString(fs.Iterable.String())
+	out.WriteString(") ")
+	out.WriteString(fs.Body.String())
+
+	return out.String()
+}
+
+/*---------------------------------------------------------------------------*/
+
+type BreakStatement struct {
+	Token    token.Token // 'break' トークン
+	Comments []*Comment  // 直前と行末のコメント
+}
+
+func (bs *BreakStatement) statementNode()       {}
+func (bs *BreakStatement) TokenLiteral() string { return bs.Token.Literal }
+func (bs *BreakStatement) Pos() token.Position  { return bs.Token.Pos }
+func (bs *BreakStatement) End() token.Position  { return bs.Token.End }
+func (bs *BreakStatement) String() string       { return bs.Token.Literal + ";" }
+
+/*---------------------------------------------------------------------------*/
+
+type ContinueStatement struct {
+	Token    token.Token // 'continue' トークン
+	Comments []*Comment  // 直前と行末のコメント
+}
+
+func (cs *ContinueStatement) statementNode()       {}
+func (cs *ContinueStatement) TokenLiteral() string { return cs.Token.Literal }
+func (cs *ContinueStatement) Pos() token.Position  { return cs.Token.Pos }
+func (cs *ContinueStatement) End() token.Position  { return cs.Token.End }
+func (cs *ContinueStatement) String() string       { return cs.Token.Literal + ";" }
+
+/*---------------------------------------------------------------------------*/
+
+// TryStatement : try { <body> } catch (<param>) { <catch> } finally { <finally> }
+//
+// catch と finally はどちらか一方を省略できる
+type TryStatement struct {
+	Token    token.Token // 'try' トークン
+	Body     *BlockStatement
+	Param    *Identifier     // catch (e) の e、catch が無ければ nil
+	Catch    *BlockStatement // 省略された場合は nil
+	Finally  *BlockStatement // 省略された場合は nil
+	Comments []*Comment      // 直前と行末のコメント
+}
+
+func (ts *TryStatement) statementNode()       {}
+func (ts *TryStatement) TokenLiteral() string { return ts.Token.Literal }
+func (ts *TryStatement) Pos() token.Position  { return ts.Token.Pos }
+func (ts *TryStatement) End() token.Position {
+	if ts.Finally != nil {
+		return ts.Finally.End()
+	}
+	if ts.Catch != nil {
+		return ts.Catch.End()
+	}
+	return ts.Body.End()
+}
+func (ts *TryStatement) String() string {
+	var out bytes.Buffer
+
+	out.WriteString("try ")
+	out.WriteString(ts.Body.String())
+	if ts.Catch != nil {
+		out.WriteString(" catch (" + ts.Param.String() + ") ")
+		out.WriteString(ts.Catch.String())
+	}
+	if ts.Finally != nil {
+		out.WriteString(" finally ")
+		out.WriteString(ts.Finally.String())
+	}
+
+	return out.String()
+}
+
+/*---------------------------------------------------------------------------*/
+
+// ThrowStatement : throw <expression>
+type ThrowStatement struct {
+	Token    token.Token // 'throw' トークン
+	Value    Expression
+	Comments []*Comment // 直前と行末のコメント
+}
+
+func (ts *ThrowStatement) statementNode()       {}
+func (ts *ThrowStatement) TokenLiteral() string { return ts.Token.Literal }
+func (ts *ThrowStatement) Pos() token.Position  { return ts.Token.Pos }
+func (ts *ThrowStatement) End() token.Position {
+	if ts.Value != nil {
+		return ts.Value.End()
+	}
+	return ts.Token.End
+}
+func (ts *ThrowStatement) String() string {
+	return ts.TokenLiteral() + " " + ts.Value.String() + ";"
+}
+
+/*---------------------------------------------------------------------------*/
+
+// endAfter : position immediately after the closing delimiter at pos,
+// fallback is used when the delimiter position is unknown
+func endAfter(pos token.Position, fallback token.Position) token.Position {
+	if !pos.IsValid() {
+		return fallback
+	}
+	pos.Offset++
+	pos.Column++
+	return pos
+}
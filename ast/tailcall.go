@@ -0,0 +1,54 @@
+package ast
+
+// MarkTailCalls : 関数本体の中で末尾位置にある呼び出し式に Tail を立てる
+//
+// 末尾位置とみなすのは次の場所
+//   - 関数本体の最後の式文
+//   - 末尾位置にある if 式の各ブロックの最後の式文
+//   - return 文の値 (ループの中にあっても関数を抜けるため末尾位置になる)
+//
+// 入れ子の関数リテラルの本体はその関数を parse したときに処理されるため、ここでは辿らない
+func MarkTailCalls(body *BlockStatement) {
+	markTailBlock(body, true)
+}
+
+// last が true のとき、block の最後の式文は末尾位置にある
+func markTailBlock(block *BlockStatement, last bool) {
+	if block == nil {
+		return
+	}
+
+	for i, statement := range block.Statements {
+		tail := last && i == len(block.Statements)-1
+
+		switch stmt := statement.(type) {
+		case *ReturnStatement:
+			markTailExpression(stmt.ReturnValue)
+
+		case *ExpressionStatement:
+			if tail {
+				markTailExpression(stmt.Expression)
+			} else if ie, ok := stmt.Expression.(*IfExpression); ok {
+				// 末尾位置に無い if の中でも return は末尾位置になる
+				markTailBlock(ie.Consequence, false)
+				markTailBlock(ie.Alternative, false)
+			}
+
+		case *WhileStatement:
+			markTailBlock(stmt.Body, false)
+
+		case *ForStatement:
+			markTailBlock(stmt.Body, false)
+		}
+	}
+}
+
+func markTailExpression(exp Expression) {
+	switch exp := exp.(type) {
+	case *CallExpression:
+		exp.Tail = true
+	case *IfExpression:
+		markTailBlock(exp.Consequence, true)
+		markTailBlock(exp.Alternative, true)
+	}
+}
@@ -7,19 +7,35 @@ import (
 )
 
 var builtins = map[string]*object.Builtin{
+	// len(x) : 文字列の場合はバイト数を返す
+	// len(str, true) : 文字列の長さを文字 (rune) 数で返す
 	"len": &object.Builtin{
 		Fn: func(args ...object.Object) object.Object {
-			if len(args) != 1 {
-				return newError("wrong number of arguments. got=%d, want=1",
+			if len(args) != 1 && len(args) != 2 {
+				return newError(object.ARGUMENT_ERROR, "wrong number of arguments. got=%d, want=1 or 2",
 					len(args))
 			}
+			runes := false
+			if len(args) == 2 {
+				flag, ok := args[1].(*object.Boolean)
+				if !ok {
+					return newError(object.TYPE_ERROR, "second argument to `len` must be BOOLEAN, got %s",
+						args[1].Type())
+				}
+				runes = flag.Value
+			}
 			switch arg := args[0].(type) {
 			case *object.Array:
 				return &object.Integer{Value: int64(len(arg.Elements))}
+			case *object.Range:
+				return &object.Integer{Value: arg.Len()}
 			case *object.String:
+				if runes {
+					return &object.Integer{Value: int64(arg.RuneLen())}
+				}
 				return &object.Integer{Value: int64(len(arg.Value))}
 			default:
-				return newError("argument to `len` not supported, got %s",
+				return newError(object.TYPE_ERROR, "argument to `len` not supported, got %s",
 					args[0].Type())
 			}
 		},
@@ -29,11 +45,11 @@ var builtins = map[string]*object.Builtin{
 	"first": &object.Builtin{
 		Fn: func(args ...object.Object) object.Object {
 			if len(args) != 1 {
-				return newError("wrong number of arguments. got=%d, want=1",
+				return newError(object.ARGUMENT_ERROR, "wrong number of arguments. got=%d, want=1",
 					len(args))
 			}
 			if args[0].Type() != object.ARRAY_OBJ {
-				return newError("argument to `first` must be ARRAY, got %s",
+				return newError(object.TYPE_ERROR, "argument to `first` must be ARRAY, got %s",
 					args[0].Type())
 			}
 			arr := args[0].(*object.Array)
@@ -49,11 +65,11 @@ var builtins = map[string]*object.Builtin{
 	"last": &object.Builtin{
 		Fn: func(args ...object.Object) object.Object {
 			if len(args) != 1 {
-				return newError("wrong number of arguments. got=%d, want=1",
+				return newError(object.ARGUMENT_ERROR, "wrong number of arguments. got=%d, want=1",
 					len(args))
 			}
 			if args[0].Type() != object.ARRAY_OBJ {
-				return newError("argument to `first` must be ARRAY, got %s",
+				return newError(object.TYPE_ERROR, "argument to `first` must be ARRAY, got %s",
 					args[0].Type())
 			}
 			arr := args[0].(*object.Array)
@@ -69,11 +85,11 @@ var builtins = map[string]*object.Builtin{
 	"rest": &object.Builtin{
 		Fn: func(args ...object.Object) object.Object {
 			if len(args) != 1 {
-				return newError("wrong number of arguments. got=%d, want=1",
+				return newError(object.ARGUMENT_ERROR, "wrong number of arguments. got=%d, want=1",
 					len(args))
 			}
 			if args[0].Type() != object.ARRAY_OBJ {
-				return newError("argument to `rest` must be ARRAY, got %s",
+				return newError(object.TYPE_ERROR, "argument to `rest` must be ARRAY, got %s",
 					args[0].Type())
 			}
 
@@ -92,11 +108,11 @@ var builtins = map[string]*object.Builtin{
 	"push": &object.Builtin{
 		Fn: func(args ...object.Object) object.Object {
 			if len(args) != 2 {
-				return newError("wrong number of arguments. got=%d, want=2",
+				return newError(object.ARGUMENT_ERROR, "wrong number of arguments. got=%d, want=2",
 					len(args))
 			}
 			if args[0].Type() != object.ARRAY_OBJ {
-				return newError("argument to `push` must be ARRAY, got %s",
+				return newError(object.TYPE_ERROR, "argument to `push` must be ARRAY, got %s",
 					args[0].Type())
 			}
 			arr := args[0].(*object.Array)
@@ -110,6 +126,194 @@ var builtins = map[string]*object.Builtin{
 		},
 	},
 
+	// range(end), range(start, end), range(start, end, step)
+	"range": &object.Builtin{
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) < 1 || len(args) > 3 {
+				return newError(object.ARGUMENT_ERROR, "wrong number of arguments. got=%d, want=1..3",
+					len(args))
+			}
+			values := []int64{}
+			for _, arg := range args {
+				integer, ok := arg.(*object.Integer)
+				if !ok {
+					return newError(object.TYPE_ERROR, "argument to `range` must be INTEGER, got %s",
+						arg.Type())
+				}
+				values = append(values, integer.Value)
+			}
+
+			r := &object.Range{Start: 0, Step: 1}
+			switch len(values) {
+			case 1:
+				r.End = values[0]
+			case 2:
+				r.Start, r.End = values[0], values[1]
+			case 3:
+				r.Start, r.End, r.Step = values[0], values[1], values[2]
+			}
+			if r.Step == 0 {
+				return newError(object.ARGUMENT_ERROR, "`range` step must not be zero")
+			}
+			if r.Len() < 0 {
+				return newError(object.OVERFLOW_ERROR, "`range` has too many elements: %s", r.Inspect())
+			}
+
+			return r
+		},
+	},
+
+	// error(message), error(kind, message) : throw できるエラーの値を作る
+	"error": &object.Builtin{
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) != 1 && len(args) != 2 {
+				return newError(object.ARGUMENT_ERROR, "wrong number of arguments. got=%d, want=1 or 2",
+					len(args))
+			}
+			strs := []string{}
+			for _, arg := range args {
+				str, ok := arg.(*object.String)
+				if !ok {
+					return newError(object.TYPE_ERROR, "argument to `error` must be STRING, got %s",
+						arg.Type())
+				}
+				strs = append(strs, str.Value)
+			}
+
+			if len(strs) == 1 {
+				return &object.ErrorValue{Kind: object.ERROR, Message: strs[0]}
+			}
+			return &object.ErrorValue{Kind: object.ErrorKind(strs[0]), Message: strs[1]}
+		},
+	},
+
+	"is_error": &object.Builtin{
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) != 1 {
+				return newError(object.ARGUMENT_ERROR, "wrong number of arguments. got=%d, want=1",
+					len(args))
+			}
+			return nativeBoolToBooleanObject(args[0].Type() == object.ERROR_VALUE_OBJ)
+		},
+	},
+
+	"error_kind": &object.Builtin{
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) != 1 {
+				return newError(object.ARGUMENT_ERROR, "wrong number of arguments. got=%d, want=1",
+					len(args))
+			}
+			ev, ok := args[0].(*object.ErrorValue)
+			if !ok {
+				return newError(object.TYPE_ERROR, "argument to `error_kind` must be ERROR_VALUE, got %s",
+					args[0].Type())
+			}
+			return &object.String{Value: string(ev.Kind)}
+		},
+	},
+
+	"error_message": &object.Builtin{
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) != 1 {
+				return newError(object.ARGUMENT_ERROR, "wrong number of arguments. got=%d, want=1",
+					len(args))
+			}
+			ev, ok := args[0].(*object.ErrorValue)
+			if !ok {
+				return newError(object.TYPE_ERROR, "argument to `error_message` must be ERROR_VALUE, got %s",
+					args[0].Type())
+			}
+			return &object.String{Value: ev.Message}
+		},
+	},
+
+	// same(a, b) : a と b が同一のオブジェクトかどうか (== は内容で比べる)
+	"same": &object.Builtin{
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) != 2 {
+				return newError(object.ARGUMENT_ERROR, "wrong number of arguments. got=%d, want=2",
+					len(args))
+			}
+			return nativeBoolToBooleanObject(sameObject(args[0], args[1]))
+		},
+	},
+
+	// has_field(obj, name) : インスタンスが name というメンバを持っているか (親クラスのメンバも含む)
+	"has_field": &object.Builtin{
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) != 2 {
+				return newError(object.ARGUMENT_ERROR, "wrong number of arguments. got=%d, want=2",
+					len(args))
+			}
+			inst, ok := args[0].(*object.Instance)
+			if !ok {
+				return newError(object.TYPE_ERROR, "first argument to `has_field` must be INSTANCE, got %s",
+					args[0].Type())
+			}
+			name, ok := args[1].(*object.String)
+			if !ok {
+				return newError(object.TYPE_ERROR, "second argument to `has_field` must be STRING, got %s",
+					args[1].Type())
+			}
+			_, ref, _ := lookupMember(inst, name.Value)
+			return nativeBoolToBooleanObject(ref != nil)
+		},
+	},
+
+	// fields(obj) : インスタンスのメンバ (メソッドも含む) の名前の配列、名前順
+	"fields": &object.Builtin{
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) != 1 {
+				return newError(object.ARGUMENT_ERROR, "wrong number of arguments. got=%d, want=1",
+					len(args))
+			}
+			inst, ok := args[0].(*object.Instance)
+			if !ok {
+				return newError(object.TYPE_ERROR, "argument to `fields` must be INSTANCE, got %s",
+					args[0].Type())
+			}
+			elements := []object.Object{}
+			for _, name := range memberNames(inst) {
+				elements = append(elements, &object.String{Value: name})
+			}
+			return &object.Array{Elements: elements}
+		},
+	},
+
+	// instance_of(obj, Class) : obj が Class またはその子クラスのインスタンスか
+	"instance_of": &object.Builtin{
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) != 2 {
+				return newError(object.ARGUMENT_ERROR, "wrong number of arguments. got=%d, want=2",
+					len(args))
+			}
+			class, ok := args[1].(*object.Class)
+			if !ok {
+				return newError(object.TYPE_ERROR, "second argument to `instance_of` must be CLASS, got %s",
+					args[1].Type())
+			}
+			inst, ok := args[0].(*object.Instance)
+			return nativeBoolToBooleanObject(ok && isInstanceOf(inst, class))
+		},
+	},
+
+	// class_of(obj) : インスタンスを生成したクラス
+	"class_of": &object.Builtin{
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) != 1 {
+				return newError(object.ARGUMENT_ERROR, "wrong number of arguments. got=%d, want=1",
+					len(args))
+			}
+			inst, ok := args[0].(*object.Instance)
+			if !ok {
+				return newError(object.TYPE_ERROR, "argument to `class_of` must be INSTANCE, got %s",
+					args[0].Type())
+			}
+			return inst.Class
+		},
+	},
+
+	// インスタンスは Inspect から __str__ が呼び出される
 	"puts": &object.Builtin{
 		Fn: func(args ...object.Object) object.Object {
 			for _, arg := range args {
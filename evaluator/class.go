@@ -0,0 +1,241 @@
+package evaluator
+
+import (
+	"github.com/CHIKUWAODEN/monkey-for-c95/ast"
+	"github.com/CHIKUWAODEN/monkey-for-c95/object"
+)
+
+// evalClassLiteral : object.Class を作って Env に登録する
+//
+// Body は Function と同様にインスタンスを生成するときに評価する
+func evalClassLiteral(node *ast.ClassLiteral, env *object.Environment) object.Object {
+	classObj := &object.Class{
+		Name:    node.Name,
+		Env:     env,
+		Statics: object.NewEnclosedEnvironment(env),
+		Body:    node.Body,
+	}
+	// object.Class を Env に登録しておく（これがコンストラクタとして評価される）
+	// 先に登録するので class A extends A は自分自身を継承しようとしてエラーになる
+	// (extends がエラーになっても、登録したクラスの Statics は空の環境になっている)
+	// let と同じく、同じスコープで宣言済みの名前には登録できない
+	if !env.Declare(node.Name.Value, classObj, false) {
+		if env.IsConstant(node.Name.Value) {
+			return newError(object.TYPE_ERROR, "cannot assign to constant: %s", node.Name.Value)
+		}
+		return newError(object.NAME_ERROR, "identifier already declared in this scope: %s", node.Name.Value)
+	}
+
+	if node.Parent != nil {
+		parent := eval(node.Parent, env)
+		if isError(parent) {
+			return parent
+		}
+		parentClass, ok := parent.(*object.Class)
+		if !ok {
+			return newError(object.TYPE_ERROR, "class %s cannot extend %s, want CLASS",
+				node.Name.Value, parent.Type())
+		}
+		for class := parentClass; class != nil; class = class.Parent {
+			if class == classObj {
+				return newError(object.TYPE_ERROR, "cyclic inheritance: class %s extends itself",
+					node.Name.Value)
+			}
+		}
+		classObj.Parent = parentClass
+	}
+
+	if err := evalStatics(classObj, node.Body); err != nil {
+		return err
+	}
+	return classObj
+}
+
+// evalStatics : static 宣言をクラスの環境で一度だけ評価する
+//
+// 親クラスの static メンバは名前だけで参照できる (インスタンスの部分と同じ構造)
+func evalStatics(class *object.Class, body *ast.BlockStatement) object.Object {
+	outer := class.Env
+	if class.Parent != nil {
+		outer = class.Parent.Statics
+	}
+	class.Statics = object.NewEnclosedEnvironment(outer)
+
+	for _, stmt := range body.Statements {
+		static, ok := stmt.(*ast.StaticStatement)
+		if !ok {
+			continue
+		}
+		if result := eval(static.Statement, class.Statics); isError(result) {
+			return result
+		}
+	}
+	return nil
+}
+
+// instantiate : コンストラクタの呼び出しとして評価し、object.Instance を生成する
+// (クラスの本体で呼び出す関数も、このクラスの呼び出しから呼び出されたものとして数える)
+func instantiate(
+	class *object.Class,
+	args []object.Object,
+	frame *object.CallFrame,
+) object.Object {
+	instance := &object.Instance{Class: class}
+	if err := evalClassBody(instance, instance, frame); err != nil {
+		return err
+	}
+
+	// もしコンストラクタを持っているならこの時点で関数として評価してやる
+	// 自分のクラスに無ければ親クラスのコンストラクタを使う
+	ctor, _, ok := instance.Member("constructor")
+	if !ok && len(args) > 0 {
+		return newError(object.ARGUMENT_ERROR, "wrong number of arguments to %s. got=%d, want=0",
+			class.Name.Value, len(args))
+	}
+	if ok {
+		fn, ok := ctor.(*object.Function)
+		if ok {
+			if result := applyUserFunction(fn, instance, args, frame); isError(result) {
+				return result
+			}
+		}
+	}
+	return instance
+}
+
+// evalClassBody : part.Class の本体を評価して、インスタンスのそのクラスの部分を作る
+//
+// 親クラスの部分を先に作り、その環境を outer にする。親クラスのメンバは
+// 子クラスの本体から名前だけで参照でき、同じ名前で定義し直すと上書きになる
+// 一番上の親クラスの部分はクラスを定義した環境を outer に持つ
+func evalClassBody(
+	this *object.Instance,
+	part *object.Instance,
+	frame *object.CallFrame,
+) object.Object {
+	class := part.Class
+	outer := class.Env
+
+	if class.Parent != nil {
+		part.Super = &object.Instance{Class: class.Parent}
+		if err := evalClassBody(this, part.Super, frame); err != nil {
+			return err
+		}
+		outer = part.Super.This
+	}
+
+	part.This = object.NewCallEnvironment(outer, frame)
+
+	// this を暗黙的にインスタンスの環境に束縛しておく
+	// (子クラスの部分からは outer をたどって見える)
+	if class.Parent == nil {
+		part.This.Set("this", this)
+	}
+	part.This.Set("super", &object.Super{Class: class, Instance: part.Super, This: this})
+
+	// 横着して eval を使って、Body を評価する（ちなみに、現状だとこの BlockStatement の中に return が書けてしまう）
+	// ここで評価された BlockStatement の内容は This という環境の中で処理される
+	if result := eval(class.Body, part.This); isError(result) {
+		return result
+	}
+	return nil
+}
+
+// evalSuper : メソッドを定義したクラスから見た親クラスの部分
+func evalSuper(node *ast.Super, env *object.Environment) object.Object {
+	obj, ok := env.Get("super")
+	if !ok {
+		return newError(object.SYNTAX_ERROR, "'super' used outside of a class")
+	}
+
+	super := obj.(*object.Super)
+	if super.Instance == nil {
+		return newError(object.TYPE_ERROR, "'super' used in class %s which has no parent class",
+			super.Class.Name.Value)
+	}
+	return super
+}
+
+// applySuper : super(...) で親クラスのコンストラクタを呼び出す
+//
+// 親クラスにコンストラクタが無ければ何もしない
+func applySuper(
+	super *object.Super,
+	args []object.Object,
+	frame *object.CallFrame,
+) object.Object {
+	ctor, _, ok := super.Instance.Member("constructor")
+	if !ok {
+		return NULL
+	}
+	fn, ok := ctor.(*object.Function)
+	if !ok {
+		return newError(object.TYPE_ERROR, "constructor of %s is not a function: %s",
+			super.Instance.Class.Name.Value, ctor.Type())
+	}
+	if result := applyUserFunction(fn, super.This, args, frame); isError(result) {
+		return result
+	}
+	return NULL
+}
+
+// インスタンスの環境に暗黙的に束縛している名前、メンバとしては見せない
+var implicitMembers = map[string]bool{
+	"this":  true,
+	"super": true,
+}
+
+// lookupMember : left.name を探す
+//
+// receiver は見つかったメソッドを呼び出すときに this として束縛するインスタンス
+// (ClassName.member では nil)。メンバが無ければ ref は nil になる
+func lookupMember(left object.Object, name string) (*object.Instance, *object.Reference, *object.Error) {
+	var receiver, inst *object.Instance
+
+	switch left := left.(type) {
+	case *object.Instance:
+		receiver, inst = left, left
+	case *object.Super:
+		// super.member は親クラスの部分からメンバを探す
+		receiver, inst = left.This, left.Instance
+	case *object.Class:
+		_, env, ok := left.Member(name)
+		if !ok {
+			return nil, nil, nil
+		}
+		return nil, &object.Reference{Env: env, Name: name}, nil
+	default:
+		return nil, nil, newError(object.TYPE_ERROR, "cannot access member %s of %s, want INSTANCE or CLASS",
+			name, left.Type())
+	}
+
+	if implicitMembers[name] {
+		return receiver, nil, nil
+	}
+	_, env, ok := inst.Member(name)
+	if !ok {
+		return receiver, nil, nil
+	}
+	return receiver, &object.Reference{Env: env, Name: name}, nil
+}
+
+// isInstanceOf : inst が class またはその子クラスのインスタンスか
+func isInstanceOf(inst *object.Instance, class *object.Class) bool {
+	for c := inst.Class; c != nil; c = c.Parent {
+		if c == class {
+			return true
+		}
+	}
+	return false
+}
+
+// memberNames : インスタンスのメンバの名前 (親クラスの部分も含む、名前順)
+func memberNames(inst *object.Instance) []string {
+	names := []string{}
+	for _, name := range inst.MemberNames() {
+		if !implicitMembers[name] {
+			names = append(names, name)
+		}
+	}
+	return names
+}
@@ -0,0 +1,161 @@
+package evaluator
+
+import (
+	"github.com/CHIKUWAODEN/monkey-for-c95/object"
+)
+
+// objectsEqual : == / != で使う等価性
+//
+//   - 数値は値で比べる (1 == 1.0 は true、NaN は配列の中でも自分自身と等しくない)
+//   - 文字列は内容で比べる
+//   - 配列は要素数が同じで、各要素が等しければ等しい
+//   - ハッシュはキーの集合が同じで、各キーの値が等しければ等しい
+//   - 束縛したメソッドは同じインスタンスの同じメソッドなら等しい
+//   - インスタンスは __eq__ があればその結果で比べる (配列やハッシュの要素も同じ)
+//   - それ以外 (__eq__ の無いインスタンス、関数、クラスなど) は同一のオブジェクトかどうかで比べる
+//
+// 同一かどうかは same(a, b) で調べられる。__eq__ がエラーになった場合はそのエラーを返す
+func objectsEqual(left, right object.Object, env *object.Environment) (bool, *object.Error) {
+	eq := &equality{env: env}
+	result := eq.equal(left, right)
+	return result, eq.err
+}
+
+// equality : 配列やハッシュが自分自身を含んでいても比較が終わるように、比較中の組を覚えておく
+type equality struct {
+	visiting map[[2]object.Object]bool
+	env      *object.Environment // __eq__ を呼び出す環境
+	err      *object.Error       // __eq__ のエラー、エラーになった時点で比較を打ち切る
+}
+
+func (eq *equality) equal(left, right object.Object) bool {
+	if eq.err != nil {
+		return false
+	}
+	_, leftInstance := left.(*object.Instance)
+	_, rightInstance := right.(*object.Instance)
+	if leftInstance || rightInstance {
+		return eq.instancesEqual(left, right)
+	}
+
+	// 配列やハッシュは同一のオブジェクトでも要素を比べる (NaN を含む場合は等しくない)
+	if isNumber(left) && isNumber(right) {
+		return numbersEqual(left, right)
+	}
+	if left.Type() != right.Type() {
+		return false
+	}
+
+	switch left := left.(type) {
+	case *object.String:
+		return left.Value == right.(*object.String).Value
+	case *object.Boolean:
+		return left.Value == right.(*object.Boolean).Value
+	case *object.Null:
+		return true
+	case *object.Range:
+		r := right.(*object.Range)
+		return left.Start == r.Start && left.End == r.End && left.Step == r.Step
+	case *object.ErrorValue:
+		ev := right.(*object.ErrorValue)
+		return left.Kind == ev.Kind && left.Message == ev.Message
+	case *object.BoundMethod:
+		bm := right.(*object.BoundMethod)
+		return left.Receiver == bm.Receiver && left.Function == bm.Function
+	case *object.Array:
+		return eq.enter(left, right, func() bool {
+			return eq.arraysEqual(left, right.(*object.Array))
+		})
+	case *object.Hash:
+		return eq.enter(left, right, func() bool {
+			return eq.hashesEqual(left, right.(*object.Hash))
+		})
+	}
+	return left == right
+}
+
+// instancesEqual : __eq__ があれば呼び出し、無ければ同一のオブジェクトかどうかで比べる
+func (eq *equality) instancesEqual(left, right object.Object) bool {
+	result, ok := evalOperatorMethod(nil, "==", left, right, eq.env)
+	if !ok {
+		return left == right
+	}
+	if err, ok := result.(*object.Error); ok {
+		eq.err = err
+		return false
+	}
+	return isTruthy(result)
+}
+
+// 比較中の組に再び出会った場合は、その組は等しいものとして扱う
+func (eq *equality) enter(left, right object.Object, compare func() bool) bool {
+	pair := [2]object.Object{left, right}
+	if eq.visiting[pair] {
+		return true
+	}
+	if eq.visiting == nil {
+		eq.visiting = make(map[[2]object.Object]bool)
+	}
+	eq.visiting[pair] = true
+	defer delete(eq.visiting, pair)
+
+	return compare()
+}
+
+func (eq *equality) arraysEqual(left, right *object.Array) bool {
+	if len(left.Elements) != len(right.Elements) {
+		return false
+	}
+	for i := range left.Elements {
+		if !eq.equal(left.Elements[i], right.Elements[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+func (eq *equality) hashesEqual(left, right *object.Hash) bool {
+	if len(left.Pairs) != len(right.Pairs) {
+		return false
+	}
+	for key, pair := range left.Pairs {
+		other, ok := right.Pairs[key]
+		if !ok || !eq.equal(pair.Value, other.Value) {
+			return false
+		}
+	}
+	return true
+}
+
+func numbersEqual(left, right object.Object) bool {
+	l, lok := left.(*object.Integer)
+	r, rok := right.(*object.Integer)
+	if lok && rok {
+		return l.Value == r.Value
+	}
+	return toFloat(left) == toFloat(right)
+}
+
+// sameObject : same(a, b) で使う同一性
+//
+// 整数、浮動小数点数、文字列、真偽値、null は型と値が同じなら同一とみなす
+// それ以外はオブジェクトそのものが同じ場合に限って同一になる
+func sameObject(left, right object.Object) bool {
+	if left.Type() != right.Type() {
+		return false
+	}
+
+	switch left := left.(type) {
+	case *object.Integer:
+		return left.Value == right.(*object.Integer).Value
+	case *object.Float:
+		return left.Value == right.(*object.Float).Value
+	case *object.String:
+		return left.Value == right.(*object.String).Value
+	case *object.Boolean:
+		return left.Value == right.(*object.Boolean).Value
+	case *object.Null:
+		return true
+	}
+	return left == right
+}
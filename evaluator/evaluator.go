@@ -2,31 +2,92 @@ package evaluator
 
 import (
 	"fmt"
+	"math"
+	"sort"
+	"strings"
 
 	"github.com/CHIKUWAODEN/monkey-for-c95/ast"
 	"github.com/CHIKUWAODEN/monkey-for-c95/object"
 )
 
-func Eval(node ast.Node, env *object.Environment) object.Object {
+// Run : Eval と同じように評価し、Monkey のエラーは Go の error (*object.Error) として返す
+//
+//	if _, err := evaluator.Run(program, env); err != nil {
+//		var e *object.Error
+//		if errors.As(err, &e) && e.Kind == object.TYPE_ERROR { ... }
+//	}
+func Run(node ast.Node, env *object.Environment) (object.Object, error) {
+	result := Eval(node, env)
+	if err, ok := result.(*object.Error); ok {
+		return nil, err
+	}
+	return result, nil
+}
+
+// Eval : node を評価する
+//
+// 評価中に起きた Go の panic は object.Error に変換する
+// (評価の内部からは、recover を挟まない eval を再帰的に呼び出す)
+func Eval(node ast.Node, env *object.Environment) (result object.Object) {
+	defer func() {
+		if r := recover(); r != nil {
+			result = panicToError(r)
+		}
+	}()
+
+	return eval(node, env)
+}
+
+func eval(node ast.Node, env *object.Environment) object.Object {
+	result := evalNode(node, env)
+
+	// エラーが発生した最も内側のノードの位置を記録する
+	if err, ok := result.(*object.Error); ok && !err.Pos.IsValid() {
+		err.Pos = node.Pos()
+	}
+
+	return result
+}
+
+func evalNode(node ast.Node, env *object.Environment) object.Object {
 	switch node := node.(type) {
 	case *ast.Program:
 		return evalProgram(node, env)
 
 	case *ast.ExpressionStatement:
-		return Eval(node.Expression, env)
+		return eval(node.Expression, env)
+
+	case *macroError:
+		return node.err
 
 	case *ast.BlockStatement:
 		return evalBlockStatements(node, env)
 
 	case *ast.LetStatement:
-		val := Eval(node.Value, env)
+		val := eval(node.Value, env)
 		if isError(val) {
 			return val
 		}
-		env.Set(node.Name.Value, val)
+		if !env.Declare(node.Name.Value, val, node.IsConst()) {
+			return newError(object.NAME_ERROR, "identifier already declared in this scope: %s", node.Name.Value)
+		}
+
+	case *ast.StaticStatement:
+		// static 宣言はクラスを定義したときに評価済み (evalClassLiteral)
+		// インスタンスの生成時には何もしない
+		return NULL
+
+	case *ast.FunctionStatement:
+		// 関数の環境は env なので、関数本体から自分自身を呼び出せる
+		fn := newFunction(node.Function, env)
+		if !env.Declare(node.Function.Name, fn, false) {
+			return newError(object.NAME_ERROR, "identifier already declared in this scope: %s", node.Function.Name)
+		}
+		// 関数の本体の最後の文になった場合に、Go の nil を返さないように
+		return NULL
 
 	case *ast.ReturnStatement:
-		val := Eval(node.ReturnValue, env)
+		val := eval(node.ReturnValue, env)
 		if isError(val) {
 			return val
 		}
@@ -35,46 +96,56 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 	case *ast.IfExpression:
 		return evalIfExpression(node, env)
 
+	case *ast.WhileStatement:
+		return evalWhileStatement(node, env)
+
+	case *ast.ForStatement:
+		return evalForStatement(node, env)
+
+	case *ast.TryStatement:
+		return evalTryStatement(node, env)
+
+	case *ast.ThrowStatement:
+		return evalThrowStatement(node, env)
+
+	case *ast.BreakStatement:
+		return BREAK
+
+	case *ast.ContinueStatement:
+		return CONTINUE
+
 	case *ast.PrefixExpression:
-		right := Eval(node.Right, env)
+		right := eval(node.Right, env)
 		if isError(right) {
 			return right
 		}
 		return evalPrefixExpression(node.Operator, right)
 
 	case *ast.InfixExpression:
-		left := Eval(node.Left, env)
+		left := eval(node.Left, env)
 		if isError(left) {
 			return left
 		}
 
-		right := Eval(node.Right, env)
-		if isError(right) {
-			return right
-		}
-		return evalInfixExpression(node.Operator, left, right)
-
-	case *ast.AssignmentExpression:
-		// Expression
-		left := Eval(node.Left, env)
-		if isError(left) {
-			return left
+		// && と || は短絡評価し、結果を決めたオペランドそのものを返す
+		if node.Operator == "&&" || node.Operator == "||" {
+			return evalLogicalExpression(node.Operator, left, node.Right, env)
 		}
 
-		// Expression
-		right := Eval(node.Right, env)
+		right := eval(node.Right, env)
 		if isError(right) {
 			return right
 		}
-
-		ref, ok := left.(*object.Reference)
-		if !ok {
-			newError("Assingment error, got expected reference")
+		if result, ok := evalOperatorMethod(node, node.Operator, left, right, env); ok {
+			return result
 		}
-		ref.Assign(right)
+		return evalInfixExpression(node.Operator, left, right, env)
+
+	case *ast.AssignmentExpression:
+		return evalAssignmentExpression(node, env)
 
 	case *ast.DotExpression:
-		left := Eval(node.Left, env)
+		left := eval(node.Left, env)
 		if isError(left) {
 			return left
 		}
@@ -93,7 +164,7 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 		// >> let hoge = fn() { puts(a); }
 		// >> hoge();
 		// 10
-		function := Eval(node.Function, env)
+		function := eval(node.Function, env)
 		if isError(function) {
 			return function
 		}
@@ -102,18 +173,32 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 		if len(args) == 1 && isError(args[0]) {
 			return args[0]
 		}
-		return applyFunction(function, args)
+		// 末尾位置の関数呼び出しはここでは呼び出さず、applyUserFunction のループに任せる
+		if node.Tail {
+			switch fn := function.(type) {
+			case *object.Function:
+				return &tailCall{node: node, fn: fn, args: args}
+			case *object.BoundMethod:
+				return &tailCall{node: node, fn: fn.Function, this: fn.Receiver, args: args}
+			}
+		}
+		return callFunction(node, function, args, env)
 
 	case *ast.IndexExpression:
-		left := Eval(node.Left, env)
+		left := eval(node.Left, env)
 		if isError(left) {
 			return left
 		}
-		index := Eval(node.Index, env)
+		index := eval(node.Index, env)
 		if isError(index) {
 			return index
 		}
-		return evalIndexExpression(left, index)
+		if inst, ok := left.(*object.Instance); ok {
+			if result, ok := callMethod(inst, "__index__", []object.Object{index}, node, env); ok {
+				return result
+			}
+		}
+		return evalIndexExpression(left, index, env)
 
 	case *ast.Identifier:
 		return evalIdentifier(node, env)
@@ -121,26 +206,30 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 	case *ast.This:
 		return evalThis(node, env)
 
+	case *ast.Super:
+		return evalSuper(node, env)
+
 	case *ast.IntegerLiteral:
 		return &object.Integer{Value: node.Value}
 
+	case *ast.FloatLiteral:
+		return &object.Float{Value: node.Value}
+
 	case *ast.StringLiteral:
 		return &object.String{Value: node.Value}
 
+	case *ast.TemplateLiteral:
+		return evalTemplateLiteral(node, env)
+
 	case *ast.FunctionLiteral:
-		params := node.Parameters
-		body := node.Body
-		return &object.Function{Parameters: params, Env: env, Body: body}
+		return evalFunctionLiteral(node, env)
+
+	case *ast.SpreadExpression:
+		// evalExpressions で展開されなかった場合
+		return newError(object.SYNTAX_ERROR, "spread is only allowed in call arguments and array literals")
 
 	case *ast.ClassLiteral:
-		// Body 部分は Function と同様に applyFunction のときに評価する
-		classObj := &object.Class{
-			Name: node.Name,
-			Body: node.Body,
-		}
-		// object.Class を Env に登録しておく（これがコンストラクタとして評価される）
-		env.Set(node.Name.Value, classObj)
-		return classObj
+		return evalClassLiteral(node, env)
 
 	case *ast.ArrayLiteral:
 		elements := evalExpressions(node.Elements, env)
@@ -159,67 +248,142 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 	return nil
 }
 
-func applyFunction(fn object.Object, args []object.Object) object.Object {
+// frame は呼び出し履歴の中でのこの呼び出し
+func applyFunction(
+	fn object.Object,
+	args []object.Object,
+	frame *object.CallFrame,
+) object.Object {
 	switch fn := fn.(type) {
 
 	case *object.Function:
-		extendedEnv := extendedFunctionEnv(fn, args)
-		evaluated := Eval(fn.Body, extendedEnv)
-		return unwrapReturnValue(evaluated)
+		return applyUserFunction(fn, nil, args, frame)
+
+	case *object.BoundMethod:
+		return applyUserFunction(fn.Function, fn.Receiver, args, frame)
 
 	case *object.Class:
-		// コンストラクタの呼び出しとして評価し、object.Instance を生成する
-		instance := &object.Instance{
-			Class: fn,
-			This:  object.NewEnvironment(),
-		}
-
-		// this を暗黙的にインスタンスの環境に束縛しておく
-		instance.This.Set("this", instance)
-
-		// 横着して Eval を使って、Body を評価する（ちなみに、現状だとこの BlockStatement の中に return が書けてしまう）
-		// ここで評価された BlockStatement の内容は This という環境の中で処理される
-		Eval(fn.Body, instance.This)
-
-		// もしコンストラクタを持っているならこの時点でこの appylyFunction を使って関数として評価してやる
-		ctor, ok := instance.This.Get("constructor")
-		if ok {
-			fn, ok := ctor.(*object.Function)
-			if ok {
-				extendedEnv := extendedFunctionEnv(fn, args)
-				Eval(fn.Body, extendedEnv)
-			}
-		}
-		return instance
+		return instantiate(fn, args, frame)
+
+	case *object.Super:
+		return applySuper(fn, args, frame)
 
 	case *object.Builtin:
 		return fn.Fn(args...)
 
 	default:
-		return newError("not a function: %s", fn.Type())
+		return newError(object.TYPE_ERROR, "not a function: %s", fn.Type())
 	}
 }
 
+// 引数を束縛した関数の環境を作る
+//
+// 足りない引数はデフォルト値を評価して補い、余った引数は残余引数に配列として束縛する
+// this が nil でなければ (メソッドとしての呼び出し) this も束縛する
 func extendedFunctionEnv(
 	fn *object.Function,
+	this *object.Instance,
 	args []object.Object,
-) *object.Environment {
-	env := object.NewEnclosedEnvironment(fn.Env)
+	frame *object.CallFrame,
+) (*object.Environment, *object.Error) {
+	if err := checkArity(fn, len(args)); err != nil {
+		return nil, err
+	}
+
+	env := object.NewCallEnvironment(fn.Env, frame)
+	if this != nil {
+		env.Set("this", this)
+	}
 
 	for paramIdx, param := range fn.Parameters {
-		env.Set(param.Value, args[paramIdx])
+		if paramIdx < len(args) {
+			env.Set(param.Value, args[paramIdx])
+			continue
+		}
+		// デフォルト値は先に束縛した引数を参照できる
+		value := eval(fn.Defaults[paramIdx], env)
+		if err, ok := value.(*object.Error); ok {
+			return nil, err
+		}
+		env.Set(param.Value, value)
+	}
+
+	if fn.Rest != nil {
+		rest := []object.Object{}
+		if len(args) > len(fn.Parameters) {
+			rest = append(rest, args[len(fn.Parameters):]...)
+		}
+		env.Set(fn.Rest.Value, &object.Array{Elements: rest})
+	}
+
+	return env, nil
+}
+
+// エラーメッセージ用の関数名、無名関数なら引数リストで示す
+func functionName(fn *object.Function) string {
+	if fn.Name != "" {
+		return fn.Name
+	}
+	return "fn(" + ast.ParametersString(fn.Parameters, fn.Defaults, fn.Rest) + ")"
+}
+
+func checkArity(fn *object.Function, got int) *object.Error {
+	min := len(fn.Parameters)
+	for min > 0 && fn.Defaults != nil && fn.Defaults[min-1] != nil {
+		min--
 	}
+	max := len(fn.Parameters)
 
-	return env
+	switch {
+	case fn.Rest != nil && got < min:
+		return newError(object.ARGUMENT_ERROR, "wrong number of arguments to %s. got=%d, want=%d or more",
+			functionName(fn), got, min)
+	case fn.Rest == nil && (got < min || got > max) && min == max:
+		return newError(object.ARGUMENT_ERROR, "wrong number of arguments to %s. got=%d, want=%d",
+			functionName(fn), got, min)
+	case fn.Rest == nil && (got < min || got > max):
+		return newError(object.ARGUMENT_ERROR, "wrong number of arguments to %s. got=%d, want=%d to %d",
+			functionName(fn), got, min, max)
+	}
+	return nil
 }
 
 func unwrapReturnValue(obj object.Object) object.Object {
-	if returnValue, ok := obj.(*object.ReturnValue); ok {
-		return returnValue.Value
+	switch obj := obj.(type) {
+	case *object.ReturnValue:
+		return obj.Value
+	case *object.Break, *object.Continue:
+		// 通常は parser で弾かれるが、マクロで組み立てられた AST の場合に備える
+		return newError(object.SYNTAX_ERROR, "%s is not in a loop", obj.Inspect())
 	}
 	return obj
 }
 
+// evalFunctionLiteral : 名前付きの関数式は、関数の本体から自分の名前で呼び出せるようにする
+//
+// 名前は関数だけが見える環境に束縛するので、関数式の外からは見えない
+func evalFunctionLiteral(node *ast.FunctionLiteral, env *object.Environment) object.Object {
+	if node.Name == "" || node.Inferred {
+		return newFunction(node, env)
+	}
+
+	self := object.NewEnclosedEnvironment(env)
+	fn := newFunction(node, self)
+	self.Set(node.Name, fn)
+	return fn
+}
+
+func newFunction(node *ast.FunctionLiteral, env *object.Environment) *object.Function {
+	return &object.Function{
+		Name:       node.Name,
+		Parameters: node.Parameters,
+		Defaults:   node.Defaults,
+		Rest:       node.Rest,
+		Env:        env,
+		Body:       node.Body,
+	}
+}
+
 func evalIdentifier(
 	node *ast.Identifier,
 	env *object.Environment,
@@ -239,14 +403,14 @@ func evalIdentifier(
 		return builtin
 	}
 
-	return newError("identifier not found: " + node.Value)
+	return newError(object.NAME_ERROR, "identifier not found: %s", node.Value)
 }
 
 func evalStatements(stmts []ast.Statement, env *object.Environment) object.Object {
 	var result object.Object
 
 	for _, statement := range stmts {
-		result = Eval(statement, env)
+		result = eval(statement, env)
 
 		if returnValue, ok := result.(*object.ReturnValue); ok {
 			return returnValue.Value
@@ -256,21 +420,17 @@ func evalStatements(stmts []ast.Statement, env *object.Environment) object.Objec
 	return result
 }
 
-func evalProgram(program *ast.Program, env *object.Environment) object.Object {
-	var result object.Object
-
+func evalProgram(program *ast.Program, env *object.Environment) (result object.Object) {
 	for _, statement := range program.Statements {
-		result = Eval(statement, env)
+		result = eval(statement, env)
 
 		switch result := result.(type) {
 		case *object.ReturnValue:
 			return result.Value
 		case *object.Error:
 			return result
-		}
-
-		if returnValue, ok := result.(*object.ReturnValue); ok {
-			return returnValue.Value
+		case *object.Break, *object.Continue:
+			return newError(object.SYNTAX_ERROR, "%s is not in a loop", result.Inspect())
 		}
 	}
 
@@ -281,12 +441,14 @@ func evalBlockStatements(block *ast.BlockStatement, env *object.Environment) obj
 	var result object.Object
 
 	for _, statement := range block.Statements {
-		result = Eval(statement, env)
+		result = eval(statement, env)
 
 		if result != nil {
 			rt := result.Type()
 			// ここで result の型を確認だけして、unwrap しないことで object.ReturnValue のまま eval の再帰を浮上していく
-			if rt == object.RETURN_VALUE_OBJ || rt == object.ERROR_OBJ {
+			// break / continue のシグナルも同様に、それを処理するループまで浮上させる
+			if rt == object.RETURN_VALUE_OBJ || rt == object.ERROR_OBJ ||
+				rt == object.BREAK_OBJ || rt == object.CONTINUE_OBJ {
 				return result
 			}
 		}
@@ -295,10 +457,25 @@ func evalBlockStatements(block *ast.BlockStatement, env *object.Environment) obj
 	return result
 }
 
+// CheckedArithmetic : true にすると、整数演算のオーバーフローを object.Error として報告する
+// (false の場合は int64 として桁あふれした値になる)
+var CheckedArithmetic = false
+
+// MaxCallDepth : 関数呼び出しの深さの上限、超えると "stack overflow" の object.Error になる
+// (末尾呼び出しは深さを増やさない)
+var MaxCallDepth = 10000
+
+// MaxStringLength : 文字列の繰り返しと連結で作れる文字列の長さ (バイト数) の上限
+// (Go のメモリ不足は recover できないので、超える前に object.Error にする)
+var MaxStringLength = 1 << 28
+
 var (
 	NULL  = &object.Null{}
 	TRUE  = &object.Boolean{Value: true}
 	FALSE = &object.Boolean{Value: false}
+
+	BREAK    = &object.Break{}
+	CONTINUE = &object.Continue{}
 )
 
 func nativeBoolToBooleanObject(input bool) *object.Boolean {
@@ -314,33 +491,59 @@ func evalPrefixExpression(operator string, right object.Object) object.Object {
 		return evalBangOperatorExpression(right)
 	case "-":
 		return evalMinusPrefixOperatorExpression(right)
+	case "~":
+		return evalTildePrefixOperatorExpression(right)
 	default:
-		return newError("unknown operator: %s%s", operator, right.Type())
+		return newError(object.TYPE_ERROR, "unknown operator: %s%s", operator, right.Type())
 	}
 }
 
+// env は文字列との連結でインスタンスの __str__ を呼び出すときに使う
 func evalInfixExpression(
 	operator string,
 	left, right object.Object,
+	env *object.Environment,
 ) object.Object {
 	switch {
 	case left.Type() == object.INTEGER_OBJ && right.Type() == object.INTEGER_OBJ:
 		return evalIntegerInfixExpression(operator, left, right)
+	case isNumber(left) && isNumber(right):
+		// 片方が Float なら、もう片方も Float に昇格させて計算する
+		return evalFloatInfixExpression(operator, left, right)
 	case left.Type() == object.STRING_OBJ && right.Type() == object.STRING_OBJ:
 		return evalStringInfixExpression(operator, left, right)
-	case operator == "==":
-		return nativeBoolToBooleanObject(left == right)
-	case operator == "!=":
-		return nativeBoolToBooleanObject(left != right)
+	case operator == "==" || operator == "!=":
+		equal, err := objectsEqual(left, right, env)
+		if err != nil {
+			return err
+		}
+		return nativeBoolToBooleanObject(equal == (operator == "=="))
+	case left.Type() == object.STRING_OBJ || right.Type() == object.STRING_OBJ:
+		return evalMixedStringInfixExpression(operator, left, right, env)
 	case left.Type() != right.Type():
-		return newError("type mismatch: %s %s %s",
+		return newError(object.TYPE_ERROR, "type mismatch: %s %s %s",
 			left.Type(), operator, right.Type())
 	default:
-		return newError("unknown operator: %s %s %s",
+		return newError(object.TYPE_ERROR, "unknown operator: %s %s %s",
 			left.Type(), operator, right.Type())
 	}
 }
 
+func evalLogicalExpression(
+	operator string,
+	left object.Object,
+	right ast.Expression,
+	env *object.Environment,
+) object.Object {
+	if operator == "&&" && !isTruthy(left) {
+		return left
+	}
+	if operator == "||" && isTruthy(left) {
+		return left
+	}
+	return eval(right, env)
+}
+
 func evalBangOperatorExpression(right object.Object) object.Object {
 	switch right {
 	case TRUE:
@@ -355,12 +558,26 @@ func evalBangOperatorExpression(right object.Object) object.Object {
 }
 
 func evalMinusPrefixOperatorExpression(right object.Object) object.Object {
+	switch right := right.(type) {
+	case *object.Integer:
+		if CheckedArithmetic && right.Value == math.MinInt64 {
+			return newError(object.OVERFLOW_ERROR, "integer overflow: -(%d)", right.Value)
+		}
+		return &object.Integer{Value: -right.Value}
+	case *object.Float:
+		return &object.Float{Value: -right.Value}
+	default:
+		return newError(object.TYPE_ERROR, "unknown operator: -%s", right.Type())
+	}
+}
+
+func evalTildePrefixOperatorExpression(right object.Object) object.Object {
 	if right.Type() != object.INTEGER_OBJ {
-		return newError("unknown operator: -%s", right.Type())
+		return newError(object.TYPE_ERROR, "unknown operator: ~%s", right.Type())
 	}
 
 	value := right.(*object.Integer).Value
-	return &object.Integer{Value: -value}
+	return &object.Integer{Value: ^value}
 }
 
 func evalIntegerInfixExpression(
@@ -370,6 +587,14 @@ func evalIntegerInfixExpression(
 	leftVal := left.(*object.Integer).Value
 	rightVal := right.(*object.Integer).Value
 
+	if CheckedArithmetic {
+		if value, ok := checkedIntegerOperation(operator, leftVal, rightVal); !ok {
+			return newError(object.OVERFLOW_ERROR, "integer overflow: %d %s %d", leftVal, operator, rightVal)
+		} else if value != nil {
+			return value
+		}
+	}
+
 	switch operator {
 	case "+":
 		return &object.Integer{Value: leftVal + rightVal}
@@ -378,33 +603,294 @@ func evalIntegerInfixExpression(
 	case "*":
 		return &object.Integer{Value: leftVal * rightVal}
 	case "/":
+		if rightVal == 0 {
+			return newError(object.ZERO_DIVISION_ERROR, "division by zero")
+		}
 		return &object.Integer{Value: leftVal / rightVal}
-	// [todo] - "%" operator
+	case "%":
+		if rightVal == 0 {
+			return newError(object.ZERO_DIVISION_ERROR, "modulo by zero")
+		}
+		return &object.Integer{Value: leftVal % rightVal}
+	case "**":
+		// 負の指数の場合は結果が整数にならないため Float で返す
+		if rightVal < 0 {
+			return &object.Float{Value: math.Pow(float64(leftVal), float64(rightVal))}
+		}
+		value, _ := integerPower(leftVal, rightVal)
+		return &object.Integer{Value: value}
+	case "&":
+		return &object.Integer{Value: leftVal & rightVal}
+	case "|":
+		return &object.Integer{Value: leftVal | rightVal}
+	case "^":
+		return &object.Integer{Value: leftVal ^ rightVal}
+	case "<<":
+		if rightVal < 0 {
+			return newError(object.ARGUMENT_ERROR, "negative shift count: %d", rightVal)
+		}
+		return &object.Integer{Value: leftVal << uint64(rightVal)}
+	case ">>":
+		if rightVal < 0 {
+			return newError(object.ARGUMENT_ERROR, "negative shift count: %d", rightVal)
+		}
+		return &object.Integer{Value: leftVal >> uint64(rightVal)}
 	case "<":
 		return nativeBoolToBooleanObject(leftVal < rightVal)
 	case ">":
 		return nativeBoolToBooleanObject(leftVal > rightVal)
+	case "<=":
+		return nativeBoolToBooleanObject(leftVal <= rightVal)
+	case ">=":
+		return nativeBoolToBooleanObject(leftVal >= rightVal)
 	case "==":
 		return nativeBoolToBooleanObject(leftVal == rightVal)
 	case "!=":
 		return nativeBoolToBooleanObject(leftVal != rightVal)
 	default:
-		return newError("unknown operator: %s %s %s",
+		return newError(object.TYPE_ERROR, "unknown operator: %s %s %s",
 			left.Type(), operator, right.Type())
 	}
 }
 
-func evalStringInfixExpression(
+func evalFloatInfixExpression(
 	operator string,
 	left, right object.Object,
 ) object.Object {
-	if operator != "+" {
-		return newError("unknown operator: %s %s %s",
+	leftVal := toFloat(left)
+	rightVal := toFloat(right)
+
+	switch operator {
+	case "+":
+		return &object.Float{Value: leftVal + rightVal}
+	case "-":
+		return &object.Float{Value: leftVal - rightVal}
+	case "*":
+		return &object.Float{Value: leftVal * rightVal}
+	case "/":
+		if rightVal == 0 {
+			return newError(object.ZERO_DIVISION_ERROR, "division by zero")
+		}
+		return &object.Float{Value: leftVal / rightVal}
+	case "%":
+		if rightVal == 0 {
+			return newError(object.ZERO_DIVISION_ERROR, "modulo by zero")
+		}
+		return &object.Float{Value: math.Mod(leftVal, rightVal)}
+	case "**":
+		return &object.Float{Value: math.Pow(leftVal, rightVal)}
+	case "<":
+		return nativeBoolToBooleanObject(leftVal < rightVal)
+	case ">":
+		return nativeBoolToBooleanObject(leftVal > rightVal)
+	case "<=":
+		return nativeBoolToBooleanObject(leftVal <= rightVal)
+	case ">=":
+		return nativeBoolToBooleanObject(leftVal >= rightVal)
+	case "==":
+		return nativeBoolToBooleanObject(leftVal == rightVal)
+	case "!=":
+		return nativeBoolToBooleanObject(leftVal != rightVal)
+	default:
+		return newError(object.TYPE_ERROR, "unknown operator: %s %s %s",
 			left.Type(), operator, right.Type())
 	}
+}
+
+// exponentiation by squaring, exp must not be negative
+//
+// 2 番目の戻り値は計算途中で int64 の範囲を超えなかったかどうか
+func integerPower(base, exp int64) (int64, bool) {
+	result := int64(1)
+	ok := true
+	for exp > 0 {
+		if exp&1 == 1 {
+			var mulOk bool
+			result, mulOk = multiplyInt64(result, base)
+			ok = ok && mulOk
+		}
+		exp >>= 1
+		if exp > 0 {
+			var mulOk bool
+			base, mulOk = multiplyInt64(base, base)
+			ok = ok && mulOk
+		}
+	}
+	return result, ok
+}
+
+// CheckedArithmetic モードで、オーバーフローし得る演算を検査する
+//
+// オーバーフローした場合は ok が false になる
+// 検査の対象外の演算の場合は (nil, true) を返し、通常の評価にまかせる
+func checkedIntegerOperation(operator string, left, right int64) (object.Object, bool) {
+	switch operator {
+	case "+":
+		sum := left + right
+		// 同じ符号どうしの加算で符号が変わったらオーバーフロー
+		if (left >= 0) == (right >= 0) && (sum >= 0) != (left >= 0) {
+			return nil, false
+		}
+		return &object.Integer{Value: sum}, true
+	case "-":
+		diff := left - right
+		if (left >= 0) != (right >= 0) && (diff >= 0) != (left >= 0) {
+			return nil, false
+		}
+		return &object.Integer{Value: diff}, true
+	case "*":
+		product, ok := multiplyInt64(left, right)
+		if !ok {
+			return nil, false
+		}
+		return &object.Integer{Value: product}, true
+	case "/":
+		if left == math.MinInt64 && right == -1 {
+			return nil, false
+		}
+	case "**":
+		if right >= 0 {
+			value, ok := integerPower(left, right)
+			if !ok {
+				return nil, false
+			}
+			return &object.Integer{Value: value}, true
+		}
+	}
+	return nil, true
+}
+
+// 2 番目の戻り値は積が int64 の範囲に収まったかどうか
+func multiplyInt64(a, b int64) (int64, bool) {
+	if a == 0 || b == 0 {
+		return 0, true
+	}
+	product := a * b
+	if product/b != a || (a == -1 && b == math.MinInt64) || (b == -1 && a == math.MinInt64) {
+		return product, false
+	}
+	return product, true
+}
+
+func isNumber(obj object.Object) bool {
+	rt := obj.Type()
+	return rt == object.INTEGER_OBJ || rt == object.FLOAT_OBJ
+}
+
+// Integer または Float を float64 として取り出す
+func toFloat(obj object.Object) float64 {
+	switch obj := obj.(type) {
+	case *object.Integer:
+		return float64(obj.Value)
+	case *object.Float:
+		return obj.Value
+	default:
+		return math.NaN()
+	}
+}
+
+func evalStringInfixExpression(
+	operator string,
+	left, right object.Object,
+) object.Object {
 	leftVal := left.(*object.String).Value
 	rightVal := right.(*object.String).Value
-	return &object.String{Value: leftVal + rightVal}
+
+	// 比較はバイト列の辞書順
+	switch operator {
+	case "+":
+		return concatStrings(leftVal, rightVal)
+	case "==":
+		return nativeBoolToBooleanObject(leftVal == rightVal)
+	case "!=":
+		return nativeBoolToBooleanObject(leftVal != rightVal)
+	case "<":
+		return nativeBoolToBooleanObject(leftVal < rightVal)
+	case ">":
+		return nativeBoolToBooleanObject(leftVal > rightVal)
+	case "<=":
+		return nativeBoolToBooleanObject(leftVal <= rightVal)
+	case ">=":
+		return nativeBoolToBooleanObject(leftVal >= rightVal)
+	default:
+		return newError(object.TYPE_ERROR, "unknown operator: %s %s %s",
+			left.Type(), operator, right.Type())
+	}
+}
+
+// 片方だけが文字列の場合、"ab" * 3 と 3 * "ab" は繰り返し、
+// "a" + 1 と 1 + "a" はもう片方を文字列にして (stringify) 連結する
+func evalMixedStringInfixExpression(
+	operator string,
+	left, right object.Object,
+	env *object.Environment,
+) object.Object {
+	switch operator {
+	case "+":
+		leftStr, err := stringify(left, env)
+		if err != nil {
+			return err
+		}
+		rightStr, err := stringify(right, env)
+		if err != nil {
+			return err
+		}
+		return concatStrings(leftStr, rightStr)
+	case "*":
+		str, count := left, right
+		if str.Type() != object.STRING_OBJ {
+			str, count = right, left
+		}
+		n, ok := count.(*object.Integer)
+		if !ok {
+			break
+		}
+		if n.Value < 0 {
+			return newError(object.ARGUMENT_ERROR, "negative repeat count: %d", n.Value)
+		}
+		// len * count は桁あふれすることがあるので、割り算で上限と比べる
+		value := str.(*object.String).Value
+		if len(value) > 0 && n.Value > int64(MaxStringLength/len(value)) {
+			return newError(object.OVERFLOW_ERROR, "string too long: %d bytes * %d exceeds %d",
+				len(value), n.Value, MaxStringLength)
+		}
+		return &object.String{Value: strings.Repeat(value, int(n.Value))}
+	}
+	return newError(object.TYPE_ERROR, "type mismatch: %s %s %s",
+		left.Type(), operator, right.Type())
+}
+
+// concatStrings : 連結した結果が MaxStringLength を超える場合はエラーにする
+func concatStrings(left, right string) object.Object {
+	if len(left) > MaxStringLength-len(right) {
+		return newError(object.OVERFLOW_ERROR, "string too long: %d + %d bytes exceeds %d",
+			len(left), len(right), MaxStringLength)
+	}
+	return &object.String{Value: left + right}
+}
+
+func evalTemplateLiteral(
+	node *ast.TemplateLiteral,
+	env *object.Environment,
+) object.Object {
+	var out strings.Builder
+
+	for i, text := range node.Texts {
+		out.WriteString(text)
+		if i < len(node.Values) {
+			value := eval(node.Values[i], env)
+			if isError(value) {
+				return value
+			}
+			str, err := stringify(value, env)
+			if err != nil {
+				return err
+			}
+			out.WriteString(str)
+		}
+	}
+
+	return &object.String{Value: out.String()}
 }
 
 func evalDotInfixExpression(
@@ -412,18 +898,164 @@ func evalDotInfixExpression(
 	right *ast.Identifier,
 ) object.Object {
 
-	inst, ok := left.(*object.Instance)
-	if !ok {
-		return newError("unexpecte left value type")
+	receiver, ref, err := lookupMember(left, right.Value)
+	if err != nil {
+		return err
+	}
+	if ref == nil {
+		return newError(object.NAME_ERROR, "undefined member: %s", right.Value)
 	}
 
-	_, ok = inst.This.Get(right.Value)
-	if !ok {
-		return newError("undefined member : %s", right.Value)
+	// メソッドは取り出したインスタンスに束縛する (コールバックとして渡しても this が変わらない)
+	// クラスの static メソッドは束縛しない
+	value := ref.Value()
+	if fn, ok := value.(*object.Function); ok && receiver != nil {
+		return &object.BoundMethod{Receiver: receiver, Function: fn}
+	}
+	return value
+}
+
+// evalAssignmentExpression : 左辺の種類 (識別子、メンバ、添字) に応じて代入する
+func evalAssignmentExpression(
+	node *ast.AssignmentExpression,
+	env *object.Environment,
+) object.Object {
+
+	switch left := node.Left.(type) {
+	case *ast.Identifier:
+		if left.Value == "this" {
+			return newError(object.SYNTAX_ERROR, "invalid assignment target: %s", left.String())
+		}
+		current, ok := env.Get(left.Value)
+		if !ok {
+			return newError(object.NAME_ERROR, "identifier not found: %s", left.Value)
+		}
+		value := evalAssignedValue(node, current, env)
+		if isError(value) {
+			return value
+		}
+		ref := &object.Reference{Env: env, Name: left.Value}
+		return ref.Assign(value)
+
+	case *ast.DotExpression:
+		target := eval(left.Left, env)
+		if isError(target) {
+			return target
+		}
+		if implicitMembers[left.Right.Value] {
+			return newError(object.TYPE_ERROR, "cannot assign to %s", left.Right.Value)
+		}
+		receiver, ref, err := lookupMember(target, left.Right.Value)
+		if err != nil {
+			return err
+		}
+		if ref == nil {
+			// 無いメンバへの代入は、インスタンスにメンバを追加する
+			if node.Operator != "=" {
+				return newError(object.NAME_ERROR, "undefined member: %s", left.Right.Value)
+			}
+			value := eval(node.Right, env)
+			if isError(value) {
+				return value
+			}
+			if class, ok := target.(*object.Class); ok {
+				return class.Statics.Set(left.Right.Value, value)
+			}
+			return receiver.This.Set(left.Right.Value, value)
+		}
+		value := evalAssignedValue(node, ref.Value(), env)
+		if isError(value) {
+			return value
+		}
+		return ref.Assign(value)
+
+	case *ast.IndexExpression:
+		return evalIndexAssignment(node, left, env)
+
+	default:
+		return newError(object.SYNTAX_ERROR, "invalid assignment target: %s", node.Left.String())
+	}
+}
+
+// evalAssignedValue : 代入する値を求める
+//
+// 複合代入 (+= など) では現在の値 current と右辺を演算した結果になる
+func evalAssignedValue(
+	node *ast.AssignmentExpression,
+	current object.Object,
+	env *object.Environment,
+) object.Object {
+
+	right := eval(node.Right, env)
+	if isError(right) {
+		return right
+	}
+
+	if node.Operator == "=" {
+		return right
+	}
+	operator := strings.TrimSuffix(node.Operator, "=")
+	if result, ok := evalOperatorMethod(node, operator, current, right, env); ok {
+		return result
+	}
+	return evalInfixExpression(operator, current, right, env)
+}
+
+func evalIndexAssignment(
+	node *ast.AssignmentExpression,
+	target *ast.IndexExpression,
+	env *object.Environment,
+) object.Object {
+
+	left := eval(target.Left, env)
+	if isError(left) {
+		return left
+	}
+	if ref, ok := left.(*object.Reference); ok {
+		left = ref.Value()
 	}
-	return &object.Reference{
-		Env:  inst.This,
-		Name: right.Value,
+
+	index := eval(target.Index, env)
+	if isError(index) {
+		return index
+	}
+
+	switch left := left.(type) {
+	case *object.Array:
+		i, ok := index.(*object.Integer)
+		if !ok {
+			return newError(object.TYPE_ERROR, "array index must be INTEGER, got %s", index.Type())
+		}
+		if i.Value < 0 || i.Value >= int64(len(left.Elements)) {
+			return newError(object.INDEX_ERROR, "index out of range: %d (length %d)",
+				i.Value, len(left.Elements))
+		}
+		value := evalAssignedValue(node, left.Elements[i.Value], env)
+		if isError(value) {
+			return value
+		}
+		left.Elements[i.Value] = value
+		return value
+
+	case *object.Hash:
+		key, err := hashKey(index, env)
+		if err != nil {
+			return err
+		}
+
+		var current object.Object = NULL
+		if pair, ok := left.Pairs[key]; ok {
+			current = pair.Value
+		}
+		value := evalAssignedValue(node, current, env)
+		if isError(value) {
+			return value
+		}
+		left.Pairs[key] = object.HashPair{Key: index, Value: value}
+		return value
+
+	default:
+		return newError(object.TYPE_ERROR, "index assignment not supported: %s", left.Type())
 	}
 }
 
@@ -431,41 +1063,158 @@ func evalThis(node *ast.This, env *object.Environment) object.Object {
 
 	this, ok := env.Get("this")
 	if !ok {
-		return newError("'this' not found")
+		return newError(object.NAME_ERROR, "'this' not found")
 	}
 
 	// インスタンス生成時に予め this をインスタンスの Environment に Set してある
 	instance, ok := this.(*object.Instance)
 	if !ok {
-		return newError("'this' is not instance")
+		return newError(object.TYPE_ERROR, "'this' is not instance")
 	}
 
 	return instance
 }
 
 func evalIfExpression(ie *ast.IfExpression, env *object.Environment) object.Object {
-	condition := Eval(ie.Condition, env)
+	condition := eval(ie.Condition, env)
 	if isError(condition) {
 		return condition
 	}
 
+	// if のブロックはそれぞれ独自のスコープを持つ
 	if isTruthy(condition) {
-		return Eval(ie.Consequence, env)
+		return eval(ie.Consequence, object.NewEnclosedEnvironment(env))
 	} else if ie.Alternative != nil {
-		return Eval(ie.Alternative, env)
+		return eval(ie.Alternative, object.NewEnclosedEnvironment(env))
 	} else {
 		return NULL
 	}
 }
 
-func evalIndexExpression(left, index object.Object) object.Object {
+func evalWhileStatement(ws *ast.WhileStatement, env *object.Environment) object.Object {
+	for {
+		condition := eval(ws.Condition, env)
+		if isError(condition) {
+			return condition
+		}
+		if !isTruthy(condition) {
+			return NULL
+		}
+
+		if result, next := evalLoopBody(ws.Body, object.NewEnclosedEnvironment(env)); !next {
+			return result
+		}
+	}
+}
+
+func evalForStatement(fs *ast.ForStatement, env *object.Environment) object.Object {
+	iterable := eval(fs.Iterable, env)
+	if isError(iterable) {
+		return iterable
+	}
+
+	// 1 回分の繰り返し、ループ変数は繰り返しごとのスコープに束縛する
+	step := func(key, value object.Object) (object.Object, bool) {
+		scope := object.NewEnclosedEnvironment(env)
+		if fs.Key != nil {
+			scope.Set(fs.Key.Value, key)
+		}
+		scope.Set(fs.Value.Value, value)
+		return evalLoopBody(fs.Body, scope)
+	}
+
+	switch iterable := iterable.(type) {
+	case *object.Array:
+		for i, element := range iterable.Elements {
+			if result, next := step(&object.Integer{Value: int64(i)}, element); !next {
+				return result
+			}
+		}
+
+	case *object.Hash:
+		// 変数が 1 つの場合はキーを、2 つの場合はキーと値を束縛する
+		for _, pair := range sortedHashPairs(iterable) {
+			value := pair.Value
+			if fs.Key == nil {
+				value = pair.Key
+			}
+			if result, next := step(pair.Key, value); !next {
+				return result
+			}
+		}
+
+	case *object.String:
+		i := 0
+		for _, ch := range iterable.Value {
+			if result, next := step(&object.Integer{Value: int64(i)}, &object.String{Value: string(ch)}); !next {
+				return result
+			}
+			i++
+		}
+
+	case *object.Range:
+		length := iterable.Len()
+		for i := int64(0); i < length; i++ {
+			value := &object.Integer{Value: iterable.Start + i*iterable.Step}
+			if result, next := step(&object.Integer{Value: i}, value); !next {
+				return result
+			}
+		}
+
+	default:
+		return newError(object.TYPE_ERROR, "cannot iterate over %s", iterable.Type())
+	}
+
+	return NULL
+}
+
+// ループの本体を評価する
+//
+// 2 番目の戻り値はループを続けるかどうか、続けない場合は 1 番目の戻り値がループの評価結果になる
+func evalLoopBody(body *ast.BlockStatement, env *object.Environment) (object.Object, bool) {
+	result := eval(body, env)
+	if result != nil {
+		switch result.Type() {
+		case object.BREAK_OBJ:
+			return NULL, false
+		case object.RETURN_VALUE_OBJ, object.ERROR_OBJ:
+			return result, false
+		}
+	}
+	return nil, true
+}
+
+// Hash の要素をキーの順に並べて返す (for 文の繰り返しの順序を一定にするため)
+func sortedHashPairs(hash *object.Hash) []object.HashPair {
+	pairs := make([]object.HashPair, 0, len(hash.Pairs))
+	for _, pair := range hash.Pairs {
+		pairs = append(pairs, pair)
+	}
+
+	sort.Slice(pairs, func(i, j int) bool {
+		a, b := pairs[i].Key, pairs[j].Key
+		if isNumber(a) && isNumber(b) {
+			return toFloat(a) < toFloat(b)
+		}
+		if a.Type() != b.Type() {
+			return a.Type() < b.Type()
+		}
+		return a.Inspect() < b.Inspect()
+	})
+
+	return pairs
+}
+
+func evalIndexExpression(left, index object.Object, env *object.Environment) object.Object {
 	switch {
 	case left.Type() == object.ARRAY_OBJ && index.Type() == object.INTEGER_OBJ:
 		return evalArrayIndexExpression(left, index)
 	case left.Type() == object.HASH_OBJ:
-		return evalHashIndexExpression(left, index)
+		return evalHashIndexExpression(left, index, env)
+	case left.Type() == object.ERROR_VALUE_OBJ:
+		return evalErrorValueIndexExpression(left, index)
 	default:
-		return newError("index operator not supported: %s", left.Type())
+		return newError(object.TYPE_ERROR, "index operator not supported: %s", left.Type())
 	}
 }
 
@@ -481,15 +1230,28 @@ func evalArrayIndexExpression(array, index object.Object) object.Object {
 	return arrayObject.Elements[idx]
 }
 
-func evalHashIndexExpression(hash, index object.Object) object.Object {
-	hashObject := hash.(*object.Hash)
+func evalErrorValueIndexExpression(errorValue, index object.Object) object.Object {
+	name, ok := index.(*object.String)
+	if !ok {
+		return newError(object.TYPE_ERROR, "error field name must be STRING, got %s", index.Type())
+	}
 
-	key, ok := index.(object.Hashable)
+	field, ok := errorValue.(*object.ErrorValue).Field(name.Value)
 	if !ok {
-		return newError("unusable as hash key: %s", index.Type())
+		return NULL
 	}
+	return field
+}
 
-	pair, ok := hashObject.Pairs[key.HashKey()]
+func evalHashIndexExpression(hash, index object.Object, env *object.Environment) object.Object {
+	hashObject := hash.(*object.Hash)
+
+	key, err := hashKey(index, env)
+	if err != nil {
+		return err
+	}
+
+	pair, ok := hashObject.Pairs[key]
 	if !ok {
 		return NULL
 	}
@@ -504,7 +1266,16 @@ func evalExpressions(
 	var result []object.Object
 
 	for _, e := range exps {
-		evaluated := Eval(e, env)
+		if spread, ok := e.(*ast.SpreadExpression); ok {
+			elements := evalSpreadExpression(spread, env)
+			if len(elements) == 1 && isError(elements[0]) {
+				return elements
+			}
+			result = append(result, elements...)
+			continue
+		}
+
+		evaluated := eval(e, env)
 		if isError(evaluated) {
 			return []object.Object{evaluated}
 		}
@@ -514,6 +1285,25 @@ func evalExpressions(
 	return result
 }
 
+// ...arr の要素を取り出す
+func evalSpreadExpression(
+	node *ast.SpreadExpression,
+	env *object.Environment,
+) []object.Object {
+	value := eval(node.Value, env)
+	if isError(value) {
+		return []object.Object{value}
+	}
+
+	array, ok := value.(*object.Array)
+	if !ok {
+		err := newError(object.TYPE_ERROR, "cannot spread %s, want ARRAY", value.Type())
+		err.Pos = node.Pos()
+		return []object.Object{err}
+	}
+	return array.Elements
+}
+
 func evalHashLiteral(
 	node *ast.HashLiteral,
 	env *object.Environment,
@@ -521,28 +1311,33 @@ func evalHashLiteral(
 	pairs := make(map[object.HashKey]object.HashPair)
 
 	for keyNode, valueNode := range node.Pairs {
-		key := Eval(keyNode, env)
+		key := eval(keyNode, env)
 		if isError(key) {
 			return key // as error
 		}
 
-		hashKey, ok := key.(object.Hashable)
-		if !ok {
-			return newError("unusable as hash key: %s", key.Type())
+		hashed, err := hashKey(key, env)
+		if err != nil {
+			return err
 		}
 
-		value := Eval(valueNode, env)
+		value := eval(valueNode, env)
 		if isError(value) {
 			return value // as error
 		}
 
-		hashed := hashKey.HashKey()
 		pairs[hashed] = object.HashPair{Key: key, Value: value}
 	}
 
 	return &object.Hash{Pairs: pairs}
 }
 
+// NaN は自分自身とも等しくならないため、ハッシュのキーにはできない
+func isNaN(obj object.Object) bool {
+	f, ok := obj.(*object.Float)
+	return ok && math.IsNaN(f.Value)
+}
+
 func isTruthy(obj object.Object) bool {
 	switch obj {
 	case NULL:
@@ -556,8 +1351,8 @@ func isTruthy(obj object.Object) bool {
 	}
 }
 
-func newError(format string, a ...interface{}) *object.Error {
-	return &object.Error{Message: fmt.Sprintf(format, a...)}
+func newError(kind object.ErrorKind, format string, a ...interface{}) *object.Error {
+	return &object.Error{Kind: kind, Message: fmt.Sprintf(format, a...)}
 }
 
 func isError(obj object.Object) bool {
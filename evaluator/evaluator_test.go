@@ -1,6 +1,9 @@
 package evaluator
 
 import (
+	"errors"
+	"fmt"
+	"runtime/debug"
 	"testing"
 
 	"github.com/CHIKUWAODEN/monkey-for-c95/lexer"
@@ -28,6 +31,19 @@ func TestEvalIntegerExpression(t *testing.T) {
 		{"3 * 3 * 3 + 10", 37},
 		{"3 * (3 * 3) + 10", 37},
 		{"(5 + 10 * 2 + 15 / 3) * 2 + -10", 50},
+		{"7 % 3", 1},
+		{"-7 % 3", -1},
+		{"2 ** 10", 1024},
+		{"2 ** 3 ** 2", 512},
+		{"-2 ** 2", -4},
+		{"3 ** 0", 1},
+		{"6 & 3", 2},
+		{"6 | 3", 7},
+		{"6 ^ 3", 5},
+		{"1 << 4", 16},
+		{"256 >> 4", 16},
+		{"~5", -6},
+		{"1 | 2 ^ 3 & 4 << 1", 3},
 	}
 
 	for _, tt := range tests {
@@ -36,6 +52,31 @@ func TestEvalIntegerExpression(t *testing.T) {
 	}
 }
 
+func TestEvalFloatExpression(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected float64
+	}{
+		{"3.14", 3.14},
+		{"-0.5", -0.5},
+		{"1.5 + 1.5", 3.0},
+		{"1 + 0.5", 1.5},
+		{"0.5 * 4", 2.0},
+		{"10 / 4.0", 2.5},
+		{"1e3 - 1", 999.0},
+		{"-(2 * 0.25)", -0.5},
+		{"7.5 % 2", 1.5},
+		{"2 ** 0.5 ** 2", 1.189207115002721},
+		{"2 ** -1", 0.5},
+		{"4.0 ** 0.5", 2.0},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEvalChecked(t, tt.input)
+		testFloatObject(t, evaluated, tt.expected)
+	}
+}
+
 func TestEvalBooleanExpression(t *testing.T) {
 	tests := []struct {
 		input    string
@@ -60,6 +101,23 @@ func TestEvalBooleanExpression(t *testing.T) {
 		{"(1 < 2) == false", false},
 		{"(1 > 2) == true", false},
 		{"(1 > 2) == false", true},
+		{"1.5 < 2", true},
+		{"2 > 1.5", true},
+		{"1 == 1.0", true},
+		{"0.1 + 0.2 == 0.3", false},
+		{"2.5 != 2.5", false},
+		{"1 <= 2", true},
+		{"2 <= 2", true},
+		{"3 <= 2", false},
+		{"1 >= 2", false},
+		{"2 >= 2", true},
+		{"2.5 >= 2", true},
+		{"2 <= 1.5", false},
+		{"true && true", true},
+		{"true && false", false},
+		{"false || true", true},
+		{"false || false", false},
+		{"1 < 2 && 2 < 3", true},
 	}
 
 	for _, tt := range tests {
@@ -68,6 +126,85 @@ func TestEvalBooleanExpression(t *testing.T) {
 	}
 }
 
+func TestLogicalOperators(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"false && undefined", false},
+		{"true || undefined", true},
+		{"if (false) { 1 } || 5", 5},
+		{"0 || 5", 0},
+		{"5 && 10", 10},
+		{`let name = if (false) { "x" }; name || 7`, 7},
+		{"let count = 0; let f = fn() { count }; false && f()", false},
+		{"if (1 > 2 || 3 > 2) { 10 }", 10},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEvalChecked(t, tt.input)
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case bool:
+			testBooleanObject(t, evaluated, expected)
+		}
+	}
+}
+
+func TestEquality(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected bool
+	}{
+		{`"abc" == "abc"`, true},
+		{`"abc" == "abd"`, false},
+		{`"abc" != "abd"`, true},
+		{`[1, 2] == [1, 2]`, true},
+		{`[1, 2] == [2, 1]`, false},
+		{`[1, 2] == [1, 2, 3]`, false},
+		{`[1, [2, "x"]] == [1, [2, "x"]]`, true},
+		{`[1, 2] != [1, 2]`, false},
+		{`[1, 2.0] == [1.0, 2]`, true},
+		{`[] == []`, true},
+		{`{"a": 1, "b": [2]} == {"b": [2], "a": 1}`, true},
+		{`{"a": 1} == {"a": 2}`, false},
+		{`{"a": 1} == {"b": 1}`, false},
+		{`{"a": 1} == {"a": 1, "b": 2}`, false},
+		{`{} == {}`, true},
+		{`[1] == {}`, false},
+		{`1 == "1"`, false},
+		{`"1" == 1`, false},
+		{`true == true`, true},
+		{`if (false) { 1 } == if (false) { 2 }`, true},
+		{`range(3) == range(0, 3, 1)`, true},
+		{`let a = [1]; a[0] = a; let b = [1]; b[0] = b; a == b`, true},
+		{`let inf = 1e308 * 10; let nan = inf - inf; nan == nan`, false},
+		{`let inf = 1e308 * 10; let nan = inf - inf; [nan] == [nan]`, false},
+		{`let inf = 1e308 * 10; let nan = inf - inf; let a = [nan]; a == a`, false},
+		{`let f = fn() { 1 }; f == f`, true},
+		{`fn() { 1 } == fn() { 1 }`, false},
+		{`class P { let x = 1; }; P() == P()`, false},
+		{`class P { let x = 1; }; let p = P(); p == p`, true},
+		{`error("x") == error("x")`, true},
+		{`same([1], [1])`, false},
+		{`let a = [1]; same(a, a)`, true},
+		{`let a = {}; let b = a; same(a, b)`, true},
+		{`same(1, 1)`, true},
+		{`same(1, 1.0)`, false},
+		{`same("a", "a")`, true},
+		{`same(true, true)`, true},
+		{`class P { let x = 1; }; same(P(), P())`, false},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEvalChecked(t, tt.input)
+		if !testBooleanObject(t, evaluated, tt.expected) {
+			t.Errorf("input: %s", tt.input)
+		}
+	}
+}
+
 func TestBangOperator(t *testing.T) {
 	tests := []struct {
 		input    string
@@ -178,9 +315,42 @@ if (10 > 1) {
 		}, {
 			`"Hello" - "World"`,
 			"unknown operator: STRING - STRING",
+		}, {
+			`"ab" * -1`,
+			"negative repeat count: -1",
+		}, {
+			`"a" * 100000000000`,
+			"string too long: 1 bytes * 100000000000 exceeds 268435456",
+		}, {
+			`9223372036854775807 * "ab"`,
+			"string too long: 2 bytes * 9223372036854775807 exceeds 268435456",
+		}, {
+			`"ab" - 1`,
+			"type mismatch: STRING - INTEGER",
+		}, {
+			`"ab" * 1.5`,
+			"type mismatch: STRING * FLOAT",
+		}, {
+			`"a${b}c"`,
+			"identifier not found: b",
 		}, {
 			`{"name": "Monkey"}[fn(x) { x }];`,
 			"unusable as hash key: FUNCTION",
+		}, {
+			"1 << -1",
+			"negative shift count: -1",
+		}, {
+			"1.5 & 1",
+			"unknown operator: FLOAT & INTEGER",
+		}, {
+			"~1.5",
+			"unknown operator: ~FLOAT",
+		}, {
+			"1 / 0",
+			"division by zero",
+		}, {
+			"let zero = 0; 10 % zero",
+			"modulo by zero",
 		},
 	}
 
@@ -201,45 +371,708 @@ if (10 > 1) {
 	}
 }
 
-func TestLetStatements(t *testing.T) {
+func TestErrorPosition(t *testing.T) {
+	tests := []struct {
+		input       string
+		expectedPos string
+	}{
+		{"foobar;", "1:1"},
+		{"let a = 1;\nlet b = a + true;", "2:9"},
+		{"let f = fn() {\n  x;\n};\nf();", "2:3"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEvalChecked(t, tt.input)
+
+		errObj, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Errorf("no error object returned. got=%T(%+v)",
+				evaluated, evaluated)
+			continue
+		}
+		if errObj.Pos.String() != tt.expectedPos {
+			t.Errorf("wrong error position. expected=%q, got=%q",
+				tt.expectedPos, errObj.Pos.String())
+		}
+	}
+}
+
+func TestErrorStackTrace(t *testing.T) {
+	tests := []struct {
+		input         string
+		expectedStack []string
+	}{
+		{"1 + true;", []string{}},
+		{"fn inner() { 1 + true }\nfn outer() { inner() + 1 }\nouter();",
+			[]string{"inner (2:14)", "outer (3:1)"}},
+		{"let f = fn(a) { a };\nlet g = fn() { f() + 1 };\ng();",
+			[]string{"f (2:16)", "g (3:1)"}},
+		// 末尾呼び出しは呼び出し元の履歴を置き換える
+		{"fn inner() { len(1) }\nfn outer() { inner() }\nouter();",
+			[]string{"len (1:14)", "inner (2:14)"}},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEvalChecked(t, tt.input)
+
+		errObj, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Errorf("object is not Error. got=%T (%+v)", evaluated, evaluated)
+			continue
+		}
+
+		stack := []string{}
+		for _, frame := range errObj.Stack {
+			stack = append(stack, frame.String())
+		}
+		if fmt.Sprint(stack) != fmt.Sprint(tt.expectedStack) {
+			t.Errorf("wrong stack for %q. expected=%v, got=%v",
+				tt.input, tt.expectedStack, stack)
+		}
+	}
+}
+
+func TestStackOverflow(t *testing.T) {
+	input := "fn f(n) { if (n == 0) { 0 } else { 1 + f(n - 1) } }; f(%d);"
+
+	// 既定の上限では Go のスタックを使い切る前にエラーになる
+	evaluated := testEvalChecked(t, fmt.Sprintf(input, MaxCallDepth*2))
+	errObj, ok := evaluated.(*object.Error)
+	if !ok {
+		t.Fatalf("object is not Error. got=%T (%+v)", evaluated, evaluated)
+	}
+	if errObj.Message != "stack overflow" {
+		t.Errorf("wrong error message. got=%q", errObj.Message)
+	}
+	if len(errObj.Stack) != MaxCallDepth+1 {
+		t.Errorf("wrong stack length. expected=%d, got=%d",
+			MaxCallDepth+1, len(errObj.Stack))
+	}
+
+	defer func(depth int) { MaxCallDepth = depth }(MaxCallDepth)
+	MaxCallDepth = 50
+
+	testIntegerObject(t, testEvalChecked(t, fmt.Sprintf(input, 49)), 49)
+
+	if _, ok := testEvalChecked(t, fmt.Sprintf(input, 50)).(*object.Error); !ok {
+		t.Errorf("expected stack overflow with MaxCallDepth=%d", MaxCallDepth)
+	}
+
+	// 末尾呼び出しは深さを増やさない
+	tail := "fn loop(n) { if (n == 0) { 0 } else { loop(n - 1) } }; loop(1000);"
+	testIntegerObject(t, testEvalChecked(t, tail), 0)
+}
+
+func TestTryCatch(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"try { 1 } catch (e) { 2 }", 1},
+		{"try { throw 5; 1 } catch (e) { e * 2 }", 10},
+		{"try { throw \"boom\" } catch (e) { len(e) }", 4},
+		{"try { throw [1, 2] } catch (e) { e[1] }", 2},
+		{"let f = fn() { throw 3 }; try { f() + 1 } catch (e) { e }", 3},
+		{"try { {}[fn(x) { x }] } catch (e) { len(e[\"message\"]) }", len("unusable as hash key: FUNCTION")},
+		{"try { 1 + true } catch (e) { len(e[\"type\"]) }", len("TypeError")},
+		{"let f = fn() { 1 + true }; try { f() } catch (e) { len(e[\"stack\"]) }", 1},
+		{"try { try { throw 1 } catch (e) { throw e + 1 } } catch (e) { e }", 2},
+		{"let x = 0; try { throw 1 } catch (e) { x = 2 } finally { x = x * 10 }; x;", 20},
+		{"let x = 0; try { 1 } finally { x = 3 }; x;", 3},
+		{"let x = 0; let f = fn() { try { return 1 } finally { x = 5 } }; f() + x;", 6},
+		{"let f = fn() { try { return 1 } finally { return 2 } }; f();", 2},
+		{"let i = 0; let n = 0; while (i < 5) { i += 1; try { if (i == 3) { break } } finally { n += 1 } }; n;", 3},
+		{"let n = 0; for (i in range(4)) { try { continue } finally { n += i } }; n;", 6},
+		{"let x = 0; try { try { throw 1 } finally { x = 1 } } catch (e) { x = x + e }; x;", 2},
+		{"try { throw 1 } catch (e) { let y = e }; y;", "identifier not found: y"},
+		{"try { 1 } catch (e) { 2 }; e;", "identifier not found: e"},
+		{"throw 7;", "uncaught exception: 7"},
+		{"try { throw 1 } finally { 2 }", "uncaught exception: 1"},
+		{"try { 1 } finally { throw 2 }", "uncaught exception: 2"},
+		{"try { throw 1 } catch (e) { 1 + true }", "type mismatch: INTEGER + BOOLEAN"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEvalChecked(t, tt.input)
+
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case string:
+			errObj, ok := evaluated.(*object.Error)
+			if !ok {
+				t.Errorf("object is not Error. got=%T (%+v)", evaluated, evaluated)
+				continue
+			}
+			if errObj.Message != expected {
+				t.Errorf("wrong error message. expected=%q, got=%q",
+					expected, errObj.Message)
+			}
+		}
+	}
+
+	// throw の位置と呼び出し履歴が記録される
+	evaluated := testEvalChecked(t, "let f = fn() {\n  throw 1;\n};\nf();")
+	errObj, ok := evaluated.(*object.Error)
+	if !ok {
+		t.Fatalf("object is not Error. got=%T (%+v)", evaluated, evaluated)
+	}
+	if errObj.Pos.String() != "2:3" {
+		t.Errorf("wrong error position. got=%q", errObj.Pos.String())
+	}
+	if len(errObj.Stack) != 1 || errObj.Stack[0].String() != "f (4:1)" {
+		t.Errorf("wrong stack. got=%v", errObj.Stack)
+	}
+	testIntegerObject(t, errObj.Value, 1)
+}
+
+func TestErrorKinds(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected object.ErrorKind
+	}{
+		{"1 + true", object.TYPE_ERROR},
+		{"-true", object.TYPE_ERROR},
+		{"foobar", object.NAME_ERROR},
+		{"let a = 1; let a = 2;", object.NAME_ERROR},
+		{"[1][\"a\"] = 1", object.TYPE_ERROR},
+		{"let a = [1]; a[3] = 1", object.INDEX_ERROR},
+		{"len(1, 2, 3)", object.ARGUMENT_ERROR},
+		{"fn(a) { a }()", object.ARGUMENT_ERROR},
+		{"1 / 0", object.ZERO_DIVISION_ERROR},
+		{"1 % 0", object.ZERO_DIVISION_ERROR},
+		{"1.5 / 0", object.ZERO_DIVISION_ERROR},
+		{"1.5 % 0.0", object.ZERO_DIVISION_ERROR},
+		{"1 = 2", object.SYNTAX_ERROR},
+		{"const a = 1; a = 2;", object.TYPE_ERROR},
+		{"b = 2;", object.NAME_ERROR},
+		{"fn f() { 1 + f() }; f()", object.RECURSION_ERROR},
+		{"throw 1", object.ERROR},
+		{"throw error(\"ValueError\", \"bad\")", "ValueError"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEvalChecked(t, tt.input)
+
+		errObj, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Errorf("object is not Error. got=%T (%+v)", evaluated, evaluated)
+			continue
+		}
+		if errObj.Kind != tt.expected {
+			t.Errorf("wrong error kind for %q. expected=%q, got=%q",
+				tt.input, tt.expected, errObj.Kind)
+		}
+	}
+}
+
+func TestErrorBuiltins(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"is_error(error(\"x\"))", true},
+		{"is_error(1)", false},
+		{"is_error(\"message\")", false},
+		{"try { 1 / 0 } catch (e) { is_error(e) }", true},
+		{"try { throw 5 } catch (e) { is_error(e) }", false},
+		{"error_kind(error(\"x\"))", "Error"},
+		{"error_kind(error(\"ValueError\", \"x\"))", "ValueError"},
+		{"error_message(error(\"ValueError\", \"bad value\"))", "bad value"},
+		{"try { 1 / 0 } catch (e) { error_kind(e) }", "ZeroDivisionError"},
+		{"try { foo } catch (e) { error_message(e) }", "identifier not found: foo"},
+		{"try { [1][5] = 0 } catch (e) { e[\"type\"] }", "IndexError"},
+		{"let e = error(\"KeyError\", \"k\"); try { throw e } catch (c) { error_kind(c) }", "KeyError"},
+		{"let f = fn() { throw error(\"x\") }; try { f() } catch (e) { len(e[\"stack\"]) }", 1},
+		{"try { throw error(\"x\") } catch (e) { e[\"nothing\"] }", nil},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEvalChecked(t, tt.input)
+
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case bool:
+			testBooleanObject(t, evaluated, expected)
+		case string:
+			str, ok := evaluated.(*object.String)
+			if !ok {
+				t.Errorf("object is not String. got=%T (%+v)", evaluated, evaluated)
+				continue
+			}
+			if str.Value != expected {
+				t.Errorf("wrong value. expected=%q, got=%q", expected, str.Value)
+			}
+		case nil:
+			testNullObject(t, evaluated)
+		}
+	}
+
+	errorTests := []struct {
+		input    string
+		expected string
+	}{
+		{"error()", "wrong number of arguments. got=0, want=1 or 2"},
+		{"error(1)", "argument to `error` must be STRING, got INTEGER"},
+		{"error_kind(1)", "argument to `error_kind` must be ERROR_VALUE, got INTEGER"},
+		{"error_message(\"x\")", "argument to `error_message` must be ERROR_VALUE, got STRING"},
+		{"error(\"x\")[1]", "error field name must be STRING, got INTEGER"},
+	}
+
+	for _, tt := range errorTests {
+		evaluated := testEvalChecked(t, tt.input)
+
+		errObj, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Errorf("object is not Error. got=%T (%+v)", evaluated, evaluated)
+			continue
+		}
+		if errObj.Message != tt.expected {
+			t.Errorf("wrong error message. expected=%q, got=%q",
+				tt.expected, errObj.Message)
+		}
+	}
+
+	evaluated := testEvalChecked(t, "error(\"ValueError\", \"bad\")")
+	if evaluated.Inspect() != "ValueError: bad" {
+		t.Errorf("wrong Inspect. got=%q", evaluated.Inspect())
+	}
+}
+
+func TestRunErrorsAs(t *testing.T) {
+	l := lexer.New("let a = 1;\na / 0;")
+	p := parser.New(l)
+	program := p.ParseProgram()
+
+	_, err := Run(program, object.NewEnvironment())
+	if err == nil {
+		t.Fatalf("expected error")
+	}
+
+	var e *object.Error
+	if !errors.As(fmt.Errorf("script failed: %w", err), &e) {
+		t.Fatalf("errors.As failed. got=%T", err)
+	}
+	if e.Kind != object.ZERO_DIVISION_ERROR {
+		t.Errorf("wrong kind. got=%q", e.Kind)
+	}
+	if err.Error() != "2:1: ZeroDivisionError: division by zero" {
+		t.Errorf("wrong error string. got=%q", err.Error())
+	}
+
+	result, err := Run(program.Statements[0], object.NewEnvironment())
+	if err != nil || result != nil {
+		t.Errorf("unexpected result. got=(%v, %v)", result, err)
+	}
+}
+
+func TestCheckedArithmetic(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"9223372036854775807 + 1", "integer overflow: 9223372036854775807 + 1"},
+		{"-9223372036854775807 - 2", "integer overflow: -9223372036854775807 - 2"},
+		{"4611686018427387904 * 2", "integer overflow: 4611686018427387904 * 2"},
+		{"2 ** 63", "integer overflow: 2 ** 63"},
+		{"-(-9223372036854775807 - 1)", "integer overflow: -(-9223372036854775808)"},
+		{"(-9223372036854775807 - 1) / -1", "integer overflow: -9223372036854775808 / -1"},
+		{"9223372036854775806 + 1", 9223372036854775807},
+		{"-2 ** 62 * 2", -9223372036854775808},
+		{"3 * -4", -12},
+	}
+
+	CheckedArithmetic = true
+	defer func() { CheckedArithmetic = false }()
+
+	for _, tt := range tests {
+		evaluated := testEvalChecked(t, tt.input)
+
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case string:
+			errObj, ok := evaluated.(*object.Error)
+			if !ok {
+				t.Errorf("object is not Error. got=%T (%+v)",
+					evaluated, evaluated)
+				continue
+			}
+			if errObj.Message != expected {
+				t.Errorf("wrong error message, ecpected=%q, got=%q",
+					expected, errObj.Message)
+			}
+		}
+	}
+
+	// 無効の場合は桁あふれした値になる
+	CheckedArithmetic = false
+	testIntegerObject(t, testEvalChecked(t, "9223372036854775807 + 1"), -9223372036854775808)
+}
+
+func TestPanicRecovery(t *testing.T) {
+	builtins["crash"] = &object.Builtin{
+		Fn: func(args ...object.Object) object.Object {
+			panic("something went wrong")
+		},
+	}
+	defer delete(builtins, "crash")
+
+	// alias() が末尾呼び出しになると呼び出し履歴に残らないため + 1 しておく
+	input := `let inner = fn() { crash() };
+fn outer() { let alias = inner; alias() + 1 };
+outer();`
+
+	evaluated := testEvalChecked(t, input)
+	errObj, ok := evaluated.(*object.Error)
+	if !ok {
+		t.Fatalf("object is not Error. got=%T (%+v)", evaluated, evaluated)
+	}
+
+	expectedMessage := "internal error: something went wrong"
+	if errObj.Message != expectedMessage {
+		t.Errorf("wrong error message. expected=%q, got=%q",
+			expectedMessage, errObj.Message)
+	}
+
+	expectedStack := []string{"crash (1:20)", "inner (2:33)", "outer (3:1)"}
+	if len(errObj.Stack) != len(expectedStack) {
+		t.Fatalf("wrong stack length. expected=%d, got=%d (%v)",
+			len(expectedStack), len(errObj.Stack), errObj.Stack)
+	}
+	for i, frame := range errObj.Stack {
+		if frame.String() != expectedStack[i] {
+			t.Errorf("stack[%d] wrong. expected=%q, got=%q",
+				i, expectedStack[i], frame.String())
+		}
+	}
+
+	// 末尾呼び出しで置き換わった frame は、呼び出された関数として記録される
+	// (引数の無い quote() は呼び出しを介さずに g の本体で panic する)
+	input = `fn g() { quote() + 1 };
+fn f() { g() };
+f();`
+
+	evaluated = testEvalChecked(t, input)
+	errObj, ok = evaluated.(*object.Error)
+	if !ok {
+		t.Fatalf("object is not Error. got=%T (%+v)", evaluated, evaluated)
+	}
+
+	expectedStack = []string{"g (2:10)"}
+	if len(errObj.Stack) != len(expectedStack) {
+		t.Fatalf("wrong stack length. expected=%d, got=%d (%v)",
+			len(expectedStack), len(errObj.Stack), errObj.Stack)
+	}
+	for i, frame := range errObj.Stack {
+		if frame.String() != expectedStack[i] {
+			t.Errorf("stack[%d] wrong. expected=%q, got=%q",
+				i, expectedStack[i], frame.String())
+		}
+	}
+
+	// Program 以外のノードを直接 Eval した場合も panic は Error になる
+	program := parser.New(lexer.New("crash()")).ParseProgram()
+	evaluated = Eval(program.Statements[0], object.NewEnvironment())
+	errObj, ok = evaluated.(*object.Error)
+	if !ok {
+		t.Fatalf("object is not Error. got=%T (%+v)", evaluated, evaluated)
+	}
+	if errObj.Message != expectedMessage {
+		t.Errorf("wrong error message. expected=%q, got=%q",
+			expectedMessage, errObj.Message)
+	}
+}
+
+func TestLoops(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"let i = 0; while (i < 10) { i = i + 1; }; i", 10},
+		{"let i = 0; while (true) { i = i + 1; if (i == 5) { break; } }; i", 5},
+		{"let i = 0; let sum = 0; while (i < 10) { i = i + 1; if (i % 2 == 0) { continue; } sum = sum + i; }; sum", 25},
+		{"let sum = 0; for (x in [1, 2, 3]) { sum = sum + x; }; sum", 6},
+		{"let sum = 0; for (i, x in [10, 20, 30]) { sum = sum + i * x; }; sum", 80},
+		{`let keys = ""; for (k in {"b": 2, "a": 1}) { keys = keys + k; }; keys`, "ab"},
+		{`let sum = 0; for (k, v in {"a": 1, "b": 2}) { sum = sum + v; }; sum`, 3},
+		{`let out = ""; for (ch in "値段!") { out = ch + out; }; out`, "!段値"},
+		{"let sum = 0; for (i in range(5)) { sum = sum + i; }; sum", 10},
+		{"let sum = 0; for (i in range(10, 0, -3)) { sum = sum + i; }; sum", 22},
+		{"let sum = 0; for (i in range(100000)) { sum = sum + 1; }; sum", 100000},
+		{"let f = fn() { for (x in [1, 2, 3]) { if (x == 2) { return x * 10; } } }; f()", 20},
+		{"let sum = 0; for (x in [1, 2]) { for (y in [10, 20]) { if (y == 20) { break; } sum = sum + x * y; } }; sum", 30},
+		{"while (false) { 1 }", nil},
+		{"for (x in 5) { x }", "cannot iterate over INTEGER"},
+		{"for (x in [1]) { x + true }", "type mismatch: INTEGER + BOOLEAN"},
+		{"range(1, 2, 0)", "`range` step must not be zero"},
+		{"len(range(0, 10, 3))", 4},
+		{"len(range(-9223372036854775807, 9223372036854775807, 4))", 4611686018427387904},
+		{"len(range(9223372036854775807, -9223372036854775807, -4))", 4611686018427387904},
+		{"let n = 0; for (i in range(-9223372036854775807, 9223372036854775807, 2)) { n += 1; if (n == 3) { break } }; n", 3},
+		{"range(-9223372036854775807, 9223372036854775807)", "`range` has too many elements: range(-9223372036854775807, 9223372036854775807, 1)"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEvalChecked(t, tt.input)
+
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case string:
+			switch evaluated := evaluated.(type) {
+			case *object.String:
+				if evaluated.Value != expected {
+					t.Errorf("String has wrong value. expected=%q, got=%q",
+						expected, evaluated.Value)
+				}
+			case *object.Error:
+				if evaluated.Message != expected {
+					t.Errorf("wrong error message. expected=%q, got=%q",
+						expected, evaluated.Message)
+				}
+			default:
+				t.Errorf("object is not String or Error. got=%T (%+v)",
+					evaluated, evaluated)
+			}
+		default:
+			testNullObject(t, evaluated)
+		}
+	}
+}
+
+func TestLetStatements(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"let a = 5; a;", 5},
+		{"let a = 5 * 5; a;", 25},
+		{"let a = 5; let b = a; b;", 5},
+		{"let a = 5; let b = a; let c = a + b + 5; c;", 15},
+	}
+
+	for _, tt := range tests {
+		testIntegerObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestBlockScope(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"if (true) { let x = 1; }; x", "identifier not found: x"},
+		{"let x = 1; if (true) { let x = 2; }; x", 1},
+		{"let x = 1; if (true) { x = 2; }; x", 2},
+		{"let x = 1; if (false) { 0 } else { let x = 3; x }", 3},
+		{"let i = 0; while (i < 3) { let y = i; i = i + 1; }; y", "identifier not found: y"},
+		{"for (x in [1, 2]) { x }; x", "identifier not found: x"},
+		{"let fs = []; for (x in [1, 2]) { fs = push(fs, fn() { x }); }; fs[0]() + fs[1]()", 3},
+		{"let x = 1; let x = 2;", "identifier already declared in this scope: x"},
+		{"let f = fn(a) { let a = 2; a }; f(1)", "identifier already declared in this scope: a"},
+		{"let f = fn(a) { if (true) { let a = 2; a } }; f(1)", 2},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEvalChecked(t, tt.input)
+
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case string:
+			errObj, ok := evaluated.(*object.Error)
+			if !ok {
+				t.Errorf("object is not Error. got=%T (%+v)", evaluated, evaluated)
+				continue
+			}
+			if errObj.Message != expected {
+				t.Errorf("wrong error message. expected=%q, got=%q",
+					expected, errObj.Message)
+			}
+		}
+	}
+}
+
+func TestConstStatements(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"const a = 5; a;", 5},
+		{"const a = 5; let b = a * 2; b;", 10},
+		{"const a = 5; a = 6;", "cannot assign to constant: a"},
+		{"const a = 5; let a = 6;", "identifier already declared in this scope: a"},
+		{"const a = 5; if (true) { a = 6; }", "cannot assign to constant: a"},
+		{"const a = 5; if (true) { let a = 6; a }", 6},
+		{"const a = 5; let f = fn() { a = 1; }; f();", "cannot assign to constant: a"},
+		{"class Foo { const x = 1; let constructor = fn() { this.x = 2; }; }; Foo();", "cannot assign to constant: x"},
+		{"const A = 1; class A {}; A", "cannot assign to constant: A"},
+		{"let x = 1; class x {}; x", "identifier already declared in this scope: x"},
+		{"class A {}; class A {};", "identifier already declared in this scope: A"},
+		{"const A = 1; if (true) { class A {}; 2 }", 2},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEvalChecked(t, tt.input)
+
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case string:
+			errObj, ok := evaluated.(*object.Error)
+			if !ok {
+				t.Errorf("object is not Error. got=%T (%+v)", evaluated, evaluated)
+				continue
+			}
+			if errObj.Message != expected {
+				t.Errorf("wrong error message. expected=%q, got=%q",
+					expected, errObj.Message)
+			}
+		}
+	}
+}
+
+func TestFunctionObject(t *testing.T) {
+	input := "fn(x) { x + 2; };"
+
+	evaluated := testEval(input)
+	fn, ok := evaluated.(*object.Function)
+	if !ok {
+		t.Fatalf("object is not Function. got=%T (%+v)", evaluated, evaluated)
+	}
+
+	if len(fn.Parameters) != 1 {
+		t.Fatalf("function has wrong parameters. Parameters=%+v",
+			fn.Parameters)
+	}
+
+	if fn.Parameters[0].String() != "x" {
+		t.Fatalf("parameters is not 'x'. got=%q", fn.Parameters[0])
+	}
+
+	expectedBody := "(x + 2)"
+
+	if fn.Body.String() != expectedBody {
+		t.Fatalf("body is not %q. got=%q", expectedBody, fn.Body.String())
+	}
+}
+
+func TestNamedFunctions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"fn fact(n) { if (n <= 1) { 1 } else { n * fact(n - 1) } }; fact(5);", 120},
+		{"fn even(n) { if (n == 0) { true } else { odd(n - 1) } }; fn odd(n) { if (n == 0) { false } else { even(n - 1) } }; if (even(10)) { 1 } else { 0 };", 1},
+		{"if (true) { fn f() { 1 } }; f();", "identifier not found: f"},
+		{"fn f() { 1 }; fn f() { 2 };", "identifier already declared in this scope: f"},
+		{"let g = fn f() { 1 }; f();", "identifier not found: f"},
+		{"let f = fn g(n) { if (n == 0) { 0 } else { g(n - 1) + 1 } }; f(3);", 3},
+		{"let f = fn g(n) { g }; let h = f; f = 1; if (h(0) == h) { 1 } else { 0 };", 1},
+		{"let f = fn(n) { f }; let h = f; f = 1; h(0);", 1},
+		{"fn f() { fn g() { 1 } }; let x = f(); if (x == if (false) { 1 }) { 1 } else { 0 };", 1},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEvalChecked(t, tt.input)
+
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case string:
+			errObj, ok := evaluated.(*object.Error)
+			if !ok {
+				t.Errorf("object is not Error. got=%T (%+v)", evaluated, evaluated)
+				continue
+			}
+			if errObj.Message != expected {
+				t.Errorf("wrong error message. expected=%q, got=%q",
+					expected, errObj.Message)
+			}
+		}
+	}
+}
+
+func TestFunctionName(t *testing.T) {
 	tests := []struct {
 		input    string
-		expected int64
+		expected string
 	}{
-		{"let a = 5; a;", 5},
-		{"let a = 5 * 5; a;", 25},
-		{"let a = 5; let b = a; b;", 5},
-		{"let a = 5; let b = a; let c = a + b + 5; c;", 15},
+		{"fn(x) { x };", ""},
+		{"fn add(a, b) { a + b }; add;", "add"},
+		{"let add = fn(a, b) { a + b }; add;", "add"},
+		{"let add = fn(a, b) { a + b }; let plus = add; plus;", "add"},
+		{"let f = fn g() { 1 }; f;", "g"},
+		{"let make = fn() { fn(x) { x } }; let h = make(); h;", ""},
 	}
 
 	for _, tt := range tests {
-		testIntegerObject(t, testEval(tt.input), tt.expected)
+		evaluated := testEvalChecked(t, tt.input)
+		fn, ok := evaluated.(*object.Function)
+		if !ok {
+			t.Errorf("object is not Function. got=%T (%+v)", evaluated, evaluated)
+			continue
+		}
+		if fn.Name != tt.expected {
+			t.Errorf("wrong name. expected=%q, got=%q", tt.expected, fn.Name)
+		}
+	}
+
+	evaluated := testEvalChecked(t, "fn add(a, b = 1) { a + b }; add;")
+	expectedInspect := "fn add(a, b = 1) {\n(a + b)\n}"
+	if evaluated.Inspect() != expectedInspect {
+		t.Errorf("wrong Inspect. expected=%q, got=%q", expectedInspect, evaluated.Inspect())
 	}
 }
 
-func TestFunctionObject(t *testing.T) {
-	input := "fn(x) { x + 2; };"
+func TestTailCalls(t *testing.T) {
+	// 末尾呼び出しがスタックを積むと、この深さの再帰はスタックの上限を超えて落ちる
+	defer debug.SetMaxStack(debug.SetMaxStack(16 << 20))
 
-	evaluated := testEval(input)
-	fn, ok := evaluated.(*object.Function)
-	if !ok {
-		t.Fatalf("object is not Function. got=%T (%+v)", evaluated, evaluated)
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"fn loop(n, acc) { if (n == 0) { acc } else { loop(n - 1, acc + 1) } }; loop(100000, 0);", 100000},
+		{"fn loop(n) { if (n == 0) { return 0; } return loop(n - 1); }; loop(100000);", 0},
+		{"fn even(n) { if (n == 0) { true } else { odd(n - 1) } }; fn odd(n) { if (n == 0) { false } else { even(n - 1) } }; if (even(100000)) { 1 } else { 0 };", 1},
+		{"fn loop(n) { while (true) { if (n == 0) { return 7; } return loop(n - 1); } }; loop(100000);", 7},
+		{"fn sum(n, acc = 0) { if (n == 0) { acc } else { sum(n - 1, acc + n) } }; sum(100000);", 5000050000},
+		// 末尾位置に無い呼び出しは今まで通り評価される
+		{"let n = 0; fn inc() { n += 1 }; fn f() { let i = 0; while (i < 3) { i += 1; inc() }; n }; f();", 3},
+		{"fn f(x) { x * 2 }; fn g(x) { f(x) + 1 }; g(5);", 11},
+		{"fn f(a) { a }; fn g() { f() }; g();", "wrong number of arguments to f. got=0, want=1"},
 	}
 
-	if len(fn.Parameters) != 1 {
-		t.Fatalf("function has wrong parameters. Parameters=%+v",
-			fn.Parameters)
-	}
+	for _, tt := range tests {
+		evaluated := testEvalChecked(t, tt.input)
 
-	if fn.Parameters[0].String() != "x" {
-		t.Fatalf("parameters is not 'x'. got=%q", fn.Parameters[0])
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case string:
+			errObj, ok := evaluated.(*object.Error)
+			if !ok {
+				t.Errorf("object is not Error. got=%T (%+v)", evaluated, evaluated)
+				continue
+			}
+			if errObj.Message != expected {
+				t.Errorf("wrong error message. expected=%q, got=%q",
+					expected, errObj.Message)
+			}
+		}
 	}
 
-	expectedBody := "(x + 2)"
-
-	if fn.Body.String() != expectedBody {
-		t.Fatalf("body is not %q. got=%q", expectedBody, fn.Body.String())
+	// コンストラクタの本体の末尾呼び出し
+	input := "class C { let v = 0; let set = fn(x) { v = x }; let constructor = fn(x) { set(x) }; }; C(5);"
+	instance, ok := testEvalChecked(t, input).(*object.Instance)
+	if !ok {
+		t.Fatalf("object is not Instance. got=%T", testEvalChecked(t, input))
 	}
+	v, _ := instance.This.Get("v")
+	testIntegerObject(t, v, 5)
 }
 
 func TestClassObject(t *testing.T) {
@@ -267,6 +1100,295 @@ func TestClassNew(t *testing.T) {
 	}
 }
 
+func TestClassInheritance(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`
+class Animal {
+	let name = "animal";
+	let sound = fn() { "..." };
+	let speak = fn() { name + " says " + this.sound() };
+	let constructor = fn(n) { name = n };
+};
+class Dog extends Animal { let sound = fn() { "woof" }; };
+Dog("rex").speak();
+`, "rex says woof"},
+		{`
+class A {
+	let v = 0;
+	let constructor = fn(x) { v = x };
+	let describe = fn() { "A" + v };
+};
+class B extends A {
+	let constructor = fn(x) { super(x * 2) };
+	let describe = fn() { "B/" + super.describe() };
+};
+class C extends B { let describe = fn() { "C/" + super.describe() }; };
+[B(5).describe(), C(1).describe()];
+`, "[B/A10, C/B/A2]"},
+		{"class P { let base = 10; }; class Q extends P { let doubled = fn() { base * 2 }; }; Q().doubled();", 20},
+		{"class P { let n = 0; let inc = fn() { n += 1 }; }; class Q extends P { let twice = fn() { inc(); inc(); n }; }; Q().twice();", 2},
+		{"class P { let x = 1; }; class Q extends P { let x = 2; let get = fn() { [x, super.x] }; }; Q().get();", "[2, 1]"},
+		{"let greeting = \"hi\"; class G { let hello = fn() { greeting }; }; class H extends G {}; H().hello();", "hi"},
+		{"class P {}; class Q extends P {}; class R extends Q {}; R;", "class R < Q < P {}"},
+		{"class P {}; class Q extends P {}; Q();", "instance of Q < P"},
+		{"class A extends 1 {}", "class A cannot extend INTEGER, want CLASS"},
+		{"class A extends B {}", "identifier not found: B"},
+		{"class A extends A {}", "cyclic inheritance: class A extends itself"},
+		{"class A { let f = fn() { super.f() }; }; A().f();", "'super' used in class A which has no parent class"},
+		{"super();", "'super' used outside of a class"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEvalChecked(t, tt.input)
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case string:
+			if errObj, ok := evaluated.(*object.Error); ok {
+				if errObj.Message != expected {
+					t.Errorf("wrong error message. expected=%q, got=%q", expected, errObj.Message)
+				}
+			} else if evaluated.Inspect() != expected {
+				t.Errorf("wrong result. expected=%q, got=%q", expected, evaluated.Inspect())
+			}
+		}
+	}
+}
+
+func TestBoundMethods(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`
+class Counter { let n = 0; let inc = fn() { this.n += 1 }; let get = fn() { n }; };
+let c = Counter();
+let call = fn(f) { f() };
+call(c.inc);
+call(c.inc);
+let get = c.get;
+get();
+`, "2"},
+		{`
+let describe = fn() { "I am " + this.name() };
+class P { let name = fn() { "P" }; let describe = describe; };
+P().describe();
+`, "I am P"},
+		{`
+class A { let who = fn() { this.name() }; let name = fn() { "A" }; };
+class B extends A { let name = fn() { "B" }; let who = fn() { "super:" + super.who() }; };
+let who = B().who;
+who();
+`, "super:B"},
+		{"class C { let inc = fn() { 1 }; }; C().inc;", "bound method inc of instance of C"},
+		{"class C { let inc = fn() { 1 }; }; let c = C(); [c.inc == c.inc, C().inc == c.inc];", "[true, false]"},
+		{`
+class L { let loop = fn(n) { if (n == 0) { return "done" }; this.loop(n - 1) }; };
+L().loop(20000);
+`, "done"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEvalChecked(t, tt.input)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result. expected=%q, got=%q", tt.expected, evaluated.Inspect())
+		}
+	}
+}
+
+func TestDynamicMembers(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"class C { let constructor = fn() { this.count = 0 }; }; let c = C(); c.count += 2; c.count;", "2"},
+		// メンバーの参照は Reference ではなく値になるので、そのまま式の中で使える
+		{"class C {}; let c = C(); c.x = 1; c.x + 1;", "2"},
+		{"class C { let v = 2; }; let c = C(); c.v * 3 == 6;", "true"},
+		{"class C {}; let c = C(); c.s = \"a\"; c.s + c.s;", "aa"},
+		{"class C {}; let c = C(); c.name = \"x\"; [has_field(c, \"name\"), has_field(c, \"other\"), has_field(c, \"this\")];", "[true, false, false]"},
+		{"class P { let a = 1; let m = fn() { a }; }; class Q extends P { let b = 2; }; let q = Q(); q.c = 3; fields(q);", "[a, b, c, m]"},
+		{"class P { let a = 1; let get = fn() { a }; }; class Q extends P {}; let q = Q(); q.a = 5; q.get();", "5"},
+		{"class C { let name = \"c\"; }; let c = C(); c.hello = fn() { \"hi \" + this.name }; c.hello();", "hi c"},
+		{"let x = 1; x.y;", "cannot access member y of INTEGER, want INSTANCE or CLASS"},
+		{"let x = 1; x.y = 2;", "cannot access member y of INTEGER, want INSTANCE or CLASS"},
+		{"class C {}; C().x;", "undefined member: x"},
+		{"class C {}; let c = C(); c.x += 1;", "undefined member: x"},
+		{"class C {}; C().this;", "undefined member: this"},
+		{"class C {}; let c = C(); c.this = 5;", "cannot assign to this"},
+		{"class C {}; let c = C(); c.super = 1;", "cannot assign to super"},
+		{"has_field(1, \"x\");", "first argument to `has_field` must be INSTANCE, got INTEGER"},
+		{"class C {}; has_field(C(), 1);", "second argument to `has_field` must be STRING, got INTEGER"},
+		{"fields([]);", "argument to `fields` must be INSTANCE, got ARRAY"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEvalChecked(t, tt.input)
+		if errObj, ok := evaluated.(*object.Error); ok {
+			if errObj.Message != tt.expected {
+				t.Errorf("wrong error message. expected=%q, got=%q", tt.expected, errObj.Message)
+			}
+		} else if evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result. expected=%q, got=%q", tt.expected, evaluated.Inspect())
+		}
+	}
+}
+
+// 定義に失敗したクラスの名前を後から使っても、Go の panic にならない (REPL で続けて入力した場合)
+func TestFailedClassDefinition(t *testing.T) {
+	env := object.NewEnvironment()
+	inputs := []struct {
+		input    string
+		expected string
+	}{
+		{"class A extends 1 {}", "class A cannot extend INTEGER, want CLASS"},
+		{"A.x", "undefined member: x"},
+		{"A.x = 1; A.x", "1"},
+	}
+
+	for _, tt := range inputs {
+		p := parser.New(lexer.New(tt.input))
+		program := p.ParseProgram()
+		if len(p.Errors()) != 0 {
+			t.Fatalf("parser has errors for %q: %q", tt.input, p.Errors())
+		}
+
+		evaluated := Eval(program, env)
+		if errObj, ok := evaluated.(*object.Error); ok {
+			if errObj.Message != tt.expected {
+				t.Errorf("wrong error message. expected=%q, got=%q", tt.expected, errObj.Message)
+			}
+		} else if evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result. expected=%q, got=%q", tt.expected, evaluated.Inspect())
+		}
+	}
+}
+
+func TestStaticMembers(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"class C { static let created = 0; let constructor = fn() { C.created += 1 }; }; C(); C(); C.created;", "2"},
+		{"class P { let x = 0; static fn make(v) { let p = P(); p.x = v; p } }; P.make(3).x;", "3"},
+		{"class M { static const base = 10; static fn scaled(n) { base * n } }; M.scaled(2);", "20"},
+		{"class A { static let tag = \"a\"; }; class B extends A { static fn show() { tag + \"b\" } }; [B.tag, B.show()];", "[a, ab]"},
+		{"class C { static let n = 0; }; has_field(C(), \"n\");", "false"},
+		{"class C {}; C.version = 2; C.version;", "2"},
+		{"class C { static const n = 0; }; C.n = 1;", "cannot assign to constant: n"},
+		{"class A {}; class B extends A {}; let b = B(); [instance_of(b, A), instance_of(b, B), instance_of(A(), B), instance_of(1, A)];", "[true, true, false, false]"},
+		{"class A {}; class B extends A {}; [class_of(B()) == B, class_of(B()) == A];", "[true, false]"},
+		{"class A {}; A.x;", "undefined member: x"},
+		{"instance_of(1, 2);", "second argument to `instance_of` must be CLASS, got INTEGER"},
+		{"class_of(1);", "argument to `class_of` must be INSTANCE, got INTEGER"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEvalChecked(t, tt.input)
+		if errObj, ok := evaluated.(*object.Error); ok {
+			if errObj.Message != tt.expected {
+				t.Errorf("wrong error message. expected=%q, got=%q", tt.expected, errObj.Message)
+			}
+		} else if evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result. expected=%q, got=%q", tt.expected, evaluated.Inspect())
+		}
+	}
+}
+
+func TestOperatorOverloading(t *testing.T) {
+	vector := `
+class Vector {
+	let x = 0;
+	let y = 0;
+	let constructor = fn(a, b) { x = a; y = b };
+	let __add__ = fn(o) { Vector(x + o.x, y + o.y) };
+	let __sub__ = fn(o) { Vector(x - o.x, y - o.y) };
+	let __mul__ = fn(k) { Vector(x * k, y * k) };
+	let __eq__ = fn(o) { instance_of(o, Vector) && x == o.x && y == o.y };
+	let __lt__ = fn(o) { x * x + y * y < o.x * o.x + o.y * o.y };
+	let __index__ = fn(i) { if (i == 0) { x } else { y } };
+	let __str__ = fn() { "Vector(${x}, ${y})" };
+	let __hash__ = fn() { "${x},${y}" };
+};
+`
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{vector + "Vector(1, 2) + Vector(3, 4);", "Vector(4, 6)"},
+		{vector + "Vector(3, 4) - Vector(1, 1);", "Vector(2, 3)"},
+		{vector + "Vector(1, 2) * 3;", "Vector(3, 6)"},
+		{vector + "[Vector(1, 2) == Vector(1, 2), Vector(1, 2) != Vector(1, 2), Vector(1, 2) == 1, 1 == Vector(1, 2)];", "[true, false, false, false]"},
+		{vector + "[Vector(1, 1) < Vector(2, 2), Vector(1, 1) > Vector(2, 2)];", "[true, false]"},
+		{vector + "let v = Vector(1, 2); v += Vector(1, 1); v;", "Vector(2, 3)"},
+		{vector + "let v = Vector(5, 6); [v[0], v[1]];", "[5, 6]"},
+		{vector + "\"v = \" + Vector(1, 2) + \" ${Vector(3, 4)}\";", "v = Vector(1, 2) Vector(3, 4)"},
+		{vector + "let h = {Vector(1, 2): \"a\"}; [h[Vector(1, 2)], h[Vector(2, 1)]];", "[a, null]"},
+		{vector + "let h = {}; h[Vector(1, 1)] = 1; h[Vector(1, 1)] += 1; h[Vector(1, 1)];", "2"},
+		{"class P {}; P() + 1;", "type mismatch: INSTANCE + INTEGER"},
+		{"class P {}; {P(): 1};", "unusable as hash key: INSTANCE"},
+		{"class P {}; P()[0];", "index operator not supported: INSTANCE"},
+		{"class P { let __str__ = fn() { 1 }; }; \"\" + P();", "__str__ of P must return STRING, got INTEGER"},
+		{"class P { let __hash__ = fn() { [] }; }; {P(): 1};", "__hash__ of P must return a hashable value, got ARRAY"},
+		{"class P { let __str__ = fn() { 1 / 0 }; }; [P()];", "[instance of P]"},
+		{"class P { let __str__ = fn() { \"${[this]}\" }; }; [P()];", "[[instance of P]]"},
+		{"class P { let __str__ = fn() { quote() }; }; [P()];", "[instance of P]"},
+		{vector + "[[Vector(1, 2)] == [Vector(1, 2)], [Vector(1, 2)] != [Vector(1, 2)], [Vector(1, 2)] == [Vector(2, 1)]];", "[true, false, false]"},
+		{vector + "[{\"a\": Vector(1, 2)} == {\"a\": Vector(1, 2)}, [1, Vector(0, 0)] == [1, 0]];", "[true, false]"},
+		{"class V { let __eq__ = fn(o) { true } }; [V() == V(), [V()] == [V()], [1] == [V()]];", "[true, true, true]"},
+		{"class V { let __eq__ = fn(o) { 1 / 0 } }; [V()] == [V()];", "division by zero"},
+		{"class P {}; let p = P(); [[p] == [p], [P()] == [P()]];", "[true, false]"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEvalChecked(t, tt.input)
+		if errObj, ok := evaluated.(*object.Error); ok {
+			if errObj.Message != tt.expected {
+				t.Errorf("wrong error message. expected=%q, got=%q", tt.expected, errObj.Message)
+			}
+		} else if evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result. expected=%q, got=%q", tt.expected, evaluated.Inspect())
+		}
+	}
+
+	// 演算子のメソッドも呼び出し履歴に残る
+	evaluated := testEvalChecked(t, "class P { let __add__ = fn(o) { o / 0 }; }; P() + 1;")
+	errObj, ok := evaluated.(*object.Error)
+	if !ok {
+		t.Fatalf("object is not Error. got=%T (%+v)", evaluated, evaluated)
+	}
+	if len(errObj.Stack) == 0 || errObj.Stack[0].Function != "__add__" {
+		t.Errorf("wrong stack. got=%v", errObj.Stack)
+	}
+}
+
+// 別々のプログラムを並行して評価しても、インスタンスの Inspect が共有の状態を書き換えない
+func TestConcurrentInstanceInspect(t *testing.T) {
+	input := `class P { let __str__ = fn() { "p" }; }; [P(), P()];`
+
+	done := make(chan string)
+	for i := 0; i < 4; i++ {
+		// parser はトレース用の状態を共有しているので、先に構文解析しておく
+		program := parser.New(lexer.New(input)).ParseProgram()
+		go func() {
+			evaluated := Eval(program, object.NewEnvironment())
+			for j := 0; j < 100; j++ {
+				evaluated.Inspect()
+			}
+			done <- evaluated.Inspect()
+		}()
+	}
+	for i := 0; i < 4; i++ {
+		if got := <-done; got != "[p, p]" {
+			t.Errorf("wrong Inspect. expected=%q, got=%q", "[p, p]", got)
+		}
+	}
+}
+
 func TestClassConstructor(t *testing.T) {
 	input := `
 class Foo
@@ -280,16 +1402,11 @@ class Foo
 let foo = Foo("Jhon doe");
 foo.myName;
 `
+	// メンバーの参照は object.Reference ではなく値そのものを返す
 	evaluated := testEval(input)
-	// str, ok := evaluated.(*object.Reference)
-	ref, ok := evaluated.(*object.Reference)
-	if !ok {
-		t.Fatalf("object is not object.Reference. got=%T (%+v)", evaluated, evaluated)
-	}
-
-	str, ok := ref.Value().(*object.String)
+	str, ok := evaluated.(*object.String)
 	if !ok {
-		t.Fatalf("str is not object.String. got=%T, (%+v)", ref.Value(), ref.Value())
+		t.Fatalf("str is not object.String. got=%T, (%+v)", evaluated, evaluated)
 	}
 
 	expectedValue := "Jhon doe"
@@ -319,6 +1436,58 @@ a;
 	}
 }
 
+func TestAssignmentSemantics(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"let a = 1; let b = 2; a = b = 3; a + b;", 6},
+		{"let a = 1; if (true) { a = 2; }; a;", 2},
+		{"let n = 0; let inc = fn() { n = n + 1; }; inc(); inc(); n;", 2},
+		{"let a = 10; a += 5; a;", 15},
+		{"let a = 10; a -= 5; a;", 5},
+		{"let a = 10; a *= 5; a;", 50},
+		{"let a = 10; a /= 5; a;", 2},
+		{"let s = \"ab\"; s += \"c\"; len(s);", 3},
+		{"let arr = [1, 2, 3]; arr[0] = 10; arr[0] + arr[1];", 12},
+		{"let arr = [1, 2, 3]; arr[2] *= 4; arr[2];", 12},
+		{"let arr = [1, 2]; let alias = arr; alias[1] = 5; arr[1];", 5},
+		{"let h = {\"k\": 1}; h[\"k\"] = 2; h[\"k\"];", 2},
+		{"let h = {}; h[\"k\"] = 3; h[\"k\"];", 3},
+		{"let h = {\"k\": 1}; h[\"k\"] += 4; h[\"k\"];", 5},
+		{"class P { let x = 1; }; let p = P(); p.x += 2;", 3},
+		{"a = 1;", "identifier not found: a"},
+		{"1 = 2;", "invalid assignment target: 1"},
+		{"let f = fn() { 1 }; f() = 2;", "invalid assignment target: f()"},
+		{"let a = 1; a + 1 = 2;", "invalid assignment target: (a + 1)"},
+		{"let arr = [1]; arr[1] = 2;", "index out of range: 1 (length 1)"},
+		{"let arr = [1]; arr[-1] = 2;", "index out of range: -1 (length 1)"},
+		{"let arr = [1]; arr[\"a\"] = 2;", "array index must be INTEGER, got STRING"},
+		{"let h = {}; h[fn(x) { x }] = 2;", "unusable as hash key: FUNCTION"},
+		{"let s = \"abc\"; s[0] = \"x\";", "index assignment not supported: STRING"},
+		{"let a = 1; a += true;", "type mismatch: INTEGER + BOOLEAN"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEvalChecked(t, tt.input)
+
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case string:
+			errObj, ok := evaluated.(*object.Error)
+			if !ok {
+				t.Errorf("object is not Error. got=%T (%+v)", evaluated, evaluated)
+				continue
+			}
+			if errObj.Message != expected {
+				t.Errorf("wrong error message. expected=%q, got=%q",
+					expected, errObj.Message)
+			}
+		}
+	}
+}
+
 func TestFunctionApplication(t *testing.T) {
 	tests := []struct {
 		input    string
@@ -337,6 +1506,61 @@ func TestFunctionApplication(t *testing.T) {
 	}
 }
 
+func TestFunctionArguments(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"let f = fn(a, b = 2) { a + b }; f(1);", 3},
+		{"let f = fn(a, b = 2) { a + b }; f(1, 5);", 6},
+		{"let f = fn(a = 1, b = a * 10) { a + b }; f();", 11},
+		{"let f = fn(a = 1, b = a * 10) { a + b }; f(2);", 22},
+		{"let n = 0; let f = fn(a = n) { a }; n = 7; f();", 7},
+		{"let f = fn(a, ...rest) { len(rest) }; f(1);", 0},
+		{"let f = fn(a, ...rest) { len(rest) }; f(1, 2, 3);", 2},
+		{"let f = fn(...rest) { rest[1] }; f(1, 2, 3);", 2},
+		{"let f = fn(a, b, c) { a + b + c }; f(...[1, 2, 3]);", 6},
+		{"let f = fn(a, b, c) { a * b + c }; let arr = [2, 3]; f(...arr, 4);", 10},
+		{"let f = fn(...rest) { len(rest) }; f(...[], 1, ...[2, 3]);", 3},
+		{"let arr = [2, 3]; let b = [1, ...arr, 4]; b[2] + len(b);", 7},
+		{"let f = fn(a, b) { a + b }; f(1);",
+			"wrong number of arguments to f. got=1, want=2"},
+		{"let f = fn(a) { a }; f(1, 2);",
+			"wrong number of arguments to f. got=2, want=1"},
+		{"fn(a, b = 1) { a }();",
+			"wrong number of arguments to fn(a, b = 1). got=0, want=1 to 2"},
+		{"fn(a, b, ...rest) { a }(1);",
+			"wrong number of arguments to fn(a, b, ...rest). got=1, want=2 or more"},
+		{"class Foo { let constructor = fn(x) { x }; }; Foo();",
+			"wrong number of arguments to constructor. got=0, want=1"},
+		{"class A {}; A(1, 2, 3);",
+			"wrong number of arguments to A. got=3, want=0"},
+		{"class A { let constructor = fn(x) { x }; }; class B extends A {}; B();",
+			"wrong number of arguments to constructor. got=0, want=1"},
+		{"let f = fn(a = b) { a }; f();", "identifier not found: b"},
+		{"let f = fn(a) { a }; f(...1);", "cannot spread INTEGER, want ARRAY"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEvalChecked(t, tt.input)
+
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case string:
+			errObj, ok := evaluated.(*object.Error)
+			if !ok {
+				t.Errorf("object is not Error. got=%T (%+v)", evaluated, evaluated)
+				continue
+			}
+			if errObj.Message != expected {
+				t.Errorf("wrong error message. expected=%q, got=%q",
+					expected, errObj.Message)
+			}
+		}
+	}
+}
+
 func TestClosures(t *testing.T) {
 	input := `
 let newAdder = fn(x) {
@@ -377,6 +1601,86 @@ func TestStringConcatenation(t *testing.T) {
 	}
 }
 
+func TestStringOperators(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`"abc" < "abd"`, true},
+		{`"abc" > "abd"`, false},
+		{`"ab" < "abc"`, true},
+		{`"b" > "abc"`, true},
+		{`"abc" <= "abc"`, true},
+		{`"abc" >= "abd"`, false},
+		{`"" < "a"`, true},
+		{`"ab" * 3`, "ababab"},
+		{`let a = [1]; a[0] = a; "x" + a`, "x[[...]]"},
+		{`3 * "ab"`, "ababab"},
+		{`"ab" * 0`, ""},
+		{`"n=" + 1`, "n=1"},
+		{`1.5 + "!"`, "1.5!"},
+		{`"list: " + [1, "a"]`, "list: [1, a]"},
+		{`"" + true + if (false) { 1 }`, "truenull"},
+		{`let x = "s"; x += 1; x`, "s1"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEvalChecked(t, tt.input)
+		switch expected := tt.expected.(type) {
+		case bool:
+			testBooleanObject(t, evaluated, expected)
+		case string:
+			testStringObject(t, evaluated, expected)
+		}
+	}
+}
+
+func TestStringLengthLimit(t *testing.T) {
+	defer func(max int) { MaxStringLength = max }(MaxStringLength)
+	MaxStringLength = 8
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`"ab" * 4`, "abababab"},
+		{`"ab" * 5`, "string too long: 2 bytes * 5 exceeds 8"},
+		{`"abcd" + "efgh"`, "abcdefgh"},
+		{`"abcd" + "efghi"`, "string too long: 4 + 5 bytes exceeds 8"},
+		{`"abcdefgh" + 1`, "string too long: 8 + 1 bytes exceeds 8"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEvalChecked(t, tt.input)
+		if errObj, ok := evaluated.(*object.Error); ok {
+			if errObj.Message != tt.expected {
+				t.Errorf("wrong error message. expected=%q, got=%q", tt.expected, errObj.Message)
+			}
+		} else {
+			testStringObject(t, evaluated, tt.expected)
+		}
+	}
+}
+
+func TestStringInterpolation(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`let name = "Monkey"; "Hello ${name}!"`, "Hello Monkey!"},
+		{`"${1 + 2} = ${3}"`, "3 = 3"},
+		{`"${[1, 2]}${true}${if (false) { 1 }}"`, "[1, 2]truenull"},
+		{`let h = {"k": "v"}; "${ h["k"] }"`, "v"},
+		{`let f = fn(x) { "<${x}>" }; "${f("${1}")}"`, "<1>"},
+		{`"\${x}"`, "${x}"},
+		{`"$x"`, "$x"},
+	}
+
+	for _, tt := range tests {
+		testStringObject(t, testEvalChecked(t, tt.input), tt.expected)
+	}
+}
+
 func TestBuiltinFunction(t *testing.T) {
 	tests := []struct {
 		input    string
@@ -386,7 +1690,11 @@ func TestBuiltinFunction(t *testing.T) {
 		{`len("four")`, 4},
 		{`len("hello world")`, 11},
 		{`len(1)`, "argument to `len` not supported, got INTEGER"},
-		{`len("one", "two")`, "wrong number of arguments. got=2, want=1"},
+		{`len("one", "two")`, "second argument to `len` must be BOOLEAN, got STRING"},
+		{`len("one", true, 1)`, "wrong number of arguments. got=3, want=1 or 2"},
+		{`len("値段")`, 6},
+		{`len("値段", true)`, 2},
+		{`len("abc", true)`, 3},
 		{`first([])`, nil},
 		{`first([1, 2, 3])`, 1},
 		{`first()`, "wrong number of arguments. got=0, want=1"},
@@ -563,6 +1871,12 @@ func TestHashIndexExpressions(t *testing.T) {
 		}, {
 			`{false: 5}[false]`,
 			5,
+		}, {
+			`{1: 5}[1.0]`,
+			5,
+		}, {
+			`{1.5: 5}[1.5]`,
+			5,
 		},
 	}
 
@@ -586,6 +1900,23 @@ func testEval(input string) object.Object {
 	return Eval(program, env)
 }
 
+// testEvalChecked : testEval と同じく評価するが、構文エラーがあればテストを失敗させる
+//
+// 構文エラーのまま評価されて、たまたま期待した結果になるのを防ぐ
+func testEvalChecked(t *testing.T, input string) object.Object {
+	t.Helper()
+
+	l := lexer.New(input)
+	p := parser.New(l)
+	program := p.ParseProgram()
+	if errors := p.Errors(); len(errors) != 0 {
+		t.Fatalf("parser has %d errors for %q: %q", len(errors), input, errors)
+	}
+	env := object.NewEnvironment()
+
+	return Eval(program, env)
+}
+
 func testIntegerObject(t *testing.T, obj object.Object, expected int64) bool {
 	result, ok := obj.(*object.Integer)
 	if !ok {
@@ -602,6 +1933,22 @@ func testIntegerObject(t *testing.T, obj object.Object, expected int64) bool {
 	return true
 }
 
+func testFloatObject(t *testing.T, obj object.Object, expected float64) bool {
+	result, ok := obj.(*object.Float)
+	if !ok {
+		t.Errorf("object is not Float. got=%T (%+v)", obj, obj)
+		return false
+	}
+
+	if result.Value != expected {
+		t.Errorf("object has wrong value got=%g, want=%g",
+			result.Value, expected)
+		return false
+	}
+
+	return true
+}
+
 func testBooleanObject(t *testing.T, obj object.Object, expected bool) bool {
 	result, ok := obj.(*object.Boolean)
 	if !ok {
@@ -617,6 +1964,21 @@ func testBooleanObject(t *testing.T, obj object.Object, expected bool) bool {
 	return true
 }
 
+func testStringObject(t *testing.T, obj object.Object, expected string) bool {
+	result, ok := obj.(*object.String)
+	if !ok {
+		t.Errorf("object is not String. got=%T (%+v)", obj, obj)
+		return false
+	}
+
+	if result.Value != expected {
+		t.Errorf("object has wrong value. got=%q, want=%q",
+			result.Value, expected)
+		return false
+	}
+	return true
+}
+
 func testNullObject(t *testing.T, obj object.Object) bool {
 	if obj != NULL {
 		t.Errorf("object is not NULL. got=%T (%+v)", obj, obj)
@@ -0,0 +1,64 @@
+package evaluator
+
+import (
+	"github.com/CHIKUWAODEN/monkey-for-c95/ast"
+	"github.com/CHIKUWAODEN/monkey-for-c95/object"
+)
+
+// throw された値は object.Error に包んで、実行時エラーと同じ経路で伝播させる
+func evalThrowStatement(ts *ast.ThrowStatement, env *object.Environment) object.Object {
+	val := eval(ts.Value, env)
+	if isError(val) {
+		return val
+	}
+
+	// エラーの値は種類とメッセージを引き継ぐ
+	if ev, ok := val.(*object.ErrorValue); ok {
+		return &object.Error{Kind: ev.Kind, Message: ev.Message, Value: ev}
+	}
+	return &object.Error{
+		Kind:    object.ERROR,
+		Message: "uncaught exception: " + val.Inspect(),
+		Value:   val,
+	}
+}
+
+func evalTryStatement(ts *ast.TryStatement, env *object.Environment) object.Object {
+	result := eval(ts.Body, object.NewEnclosedEnvironment(env))
+
+	if err, ok := result.(*object.Error); ok && ts.Catch != nil {
+		scope := object.NewEnclosedEnvironment(env)
+		scope.Set(ts.Param.Value, caughtValue(err))
+		result = eval(ts.Catch, scope)
+	}
+
+	// finally は return / break / continue やエラーで抜ける場合にも評価する
+	// finally の中でさらに制御が移る場合はそちらを優先する
+	if ts.Finally != nil {
+		finally := eval(ts.Finally, object.NewEnclosedEnvironment(env))
+		if finally != nil {
+			switch finally.Type() {
+			case object.ERROR_OBJ, object.RETURN_VALUE_OBJ,
+				object.BREAK_OBJ, object.CONTINUE_OBJ:
+				return finally
+			}
+		}
+	}
+
+	return result
+}
+
+// catch (e) の e に束縛する値
+//
+// throw された値はそのまま、実行時エラーは object.ErrorValue にする
+func caughtValue(err *object.Error) object.Object {
+	if err.Value == nil {
+		return &object.ErrorValue{Kind: err.Kind, Message: err.Message, Stack: err.Stack}
+	}
+
+	// error() で作った値には throw された時点の呼び出し履歴を記録する
+	if ev, ok := err.Value.(*object.ErrorValue); ok && ev.Stack == nil {
+		ev.Stack = err.Stack
+	}
+	return err.Value
+}
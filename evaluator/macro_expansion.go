@@ -3,11 +3,28 @@ package evaluator
 import (
 	"github.com/CHIKUWAODEN/monkey-for-c95/ast"
 	"github.com/CHIKUWAODEN/monkey-for-c95/object"
+	"github.com/CHIKUWAODEN/monkey-for-c95/token"
 )
 
 // - マクロの定義を探索
 // - マクロとして定義されているものを AST から取り除く
+//
+// 処理中にエラーになった場合は、program の文を評価するとそのエラーになる文に置き換える
+// エラーを受け取りたい場合は DefineMacrosErr を使う
 func DefineMacros(program *ast.Program, env *object.Environment) {
+	if err := DefineMacrosErr(program, env); err != nil {
+		program.Statements = []ast.Statement{&macroError{err: err.(*object.Error)}}
+	}
+}
+
+// DefineMacrosErr : DefineMacros と同じく定義を探索し、処理中に起きた Go の panic は *object.Error に変換して返す
+func DefineMacrosErr(program *ast.Program, env *object.Environment) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = macroPanicToError(r)
+		}
+	}()
+
 	definitions := []int{}
 
 	for i, statement := range program.Statements {
@@ -24,9 +41,33 @@ func DefineMacros(program *ast.Program, env *object.Environment) {
 			program.Statements[definitionIndex+1:]...,
 		)
 	}
+	return nil
 }
 
+// ExpandMacros : マクロの呼び出しを、マクロを評価した結果の AST に置き換える
+//
+// マクロの評価がエラーになった場合は、評価するとそのエラーになるプログラムを返す
+// エラーを受け取りたい場合は ExpandMacrosErr を使う
 func ExpandMacros(program ast.Node, env *object.Environment) ast.Node {
+	expanded, err := ExpandMacrosErr(program, env)
+	if err != nil {
+		return &ast.Program{
+			Statements: []ast.Statement{&macroError{err: err.(*object.Error)}},
+		}
+	}
+	return expanded
+}
+
+// ExpandMacrosErr : ExpandMacros と同じくマクロを展開する
+//
+// マクロの評価がエラーになった場合や、Go の panic が起きた場合は *object.Error を返す
+func ExpandMacrosErr(program ast.Node, env *object.Environment) (expanded ast.Node, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			expanded, err = nil, macroPanicToError(r)
+		}
+	}()
+
 	return ast.Modify(program, func(node ast.Node) ast.Node {
 		callExpression, ok := node.(*ast.CallExpression)
 		if !ok {
@@ -41,15 +82,43 @@ func ExpandMacros(program ast.Node, env *object.Environment) ast.Node {
 		args := quoteArgs(callExpression)
 		evalEnv := extendMacroEnv(macro, args)
 
-		evaluated := Eval(macro.Body, evalEnv)
+		evaluated := eval(macro.Body, evalEnv)
+		if err, ok := evaluated.(*object.Error); ok {
+			panic(err)
+		}
 
 		quote, ok := evaluated.(*object.Quote)
 		if !ok {
-			panic("we only support returning AST-nodes from macros")
+			// ast.Modify の途中で止めるために panic で ExpandMacrosErr まで戻る
+			err := newError(object.TYPE_ERROR, "macro %s must return a quoted AST node",
+				callExpression.Function.String())
+			err.Pos = callExpression.Pos()
+			panic(err)
 		}
 
 		return quote.Node
-	})
+	}), nil
+}
+
+// macroError : マクロの処理に失敗したプログラムの代わりに置く文、評価すると err になる
+//
+// ast.Statement の非公開のメソッドを満たすために埋め込んでいる (埋め込んだ値は使わない)
+type macroError struct {
+	ast.Statement
+	err *object.Error
+}
+
+func (me *macroError) TokenLiteral() string { return "" }
+func (me *macroError) String() string       { return me.err.Inspect() }
+func (me *macroError) Pos() token.Position  { return me.err.Pos }
+func (me *macroError) End() token.Position  { return me.err.Pos }
+
+// macroPanicToError : マクロの処理中に recover した値を *object.Error に変換する
+func macroPanicToError(r interface{}) *object.Error {
+	if err, ok := r.(*object.Error); ok {
+		return err
+	}
+	return panicToError(r)
 }
 
 func isMacroCall(
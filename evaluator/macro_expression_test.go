@@ -116,6 +116,47 @@ func TestExpandMacros(t *testing.T) {
 	}
 }
 
+func TestExpandMacrosErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"let m = macro() { 1 }; m();", "macro m must return a quoted AST node"},
+		{"let m = macro() { 1 / 0 }; m();", "division by zero"},
+		{"let m = macro() { quote() }; m();", "internal error: runtime error: index out of range [0] with length 0"},
+	}
+
+	for _, tt := range tests {
+		program := testParseProgram(tt.input)
+
+		env := object.NewEnvironment()
+		if err := DefineMacrosErr(program, env); err != nil {
+			t.Fatalf("DefineMacrosErr returned error: %s", err)
+		}
+		_, err := ExpandMacrosErr(program, env)
+		errObj, ok := err.(*object.Error)
+		if !ok {
+			t.Fatalf("error is not *object.Error. got=%T (%+v)", err, err)
+		}
+		if errObj.Message != tt.expected {
+			t.Errorf("wrong error message. expected=%q, got=%q", tt.expected, errObj.Message)
+		}
+
+		// ExpandMacros はエラーを返さず、評価するとそのエラーになるプログラムを返す
+		program = testParseProgram(tt.input)
+		env = object.NewEnvironment()
+		DefineMacros(program, env)
+		evaluated := Eval(ExpandMacros(program, env), object.NewEnvironment())
+		errObj, ok = evaluated.(*object.Error)
+		if !ok {
+			t.Fatalf("object is not Error. got=%T (%+v)", evaluated, evaluated)
+		}
+		if errObj.Message != tt.expected {
+			t.Errorf("wrong error message. expected=%q, got=%q", tt.expected, errObj.Message)
+		}
+	}
+}
+
 func testParseProgram(input string) *ast.Program {
 	l := lexer.New(input)
 	p := parser.New(l)
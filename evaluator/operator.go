@@ -0,0 +1,164 @@
+package evaluator
+
+import (
+	"github.com/CHIKUWAODEN/monkey-for-c95/ast"
+	"github.com/CHIKUWAODEN/monkey-for-c95/object"
+	"github.com/CHIKUWAODEN/monkey-for-c95/token"
+)
+
+// 演算子を上書きするメソッドの名前
+var operatorMethods = map[string]string{
+	"+":  "__add__",
+	"-":  "__sub__",
+	"*":  "__mul__",
+	"/":  "__div__",
+	"%":  "__mod__",
+	"==": "__eq__",
+	"<":  "__lt__",
+	">":  "__gt__",
+	"<=": "__le__",
+	">=": "__ge__",
+}
+
+// 右のオペランドだけがインスタンスの場合に、左右を入れ替えて呼び出すメソッド (a < b は b > a)
+var reflectedMethods = map[string]string{
+	"==": "__eq__",
+	"<":  "__gt__",
+	">":  "__lt__",
+	"<=": "__ge__",
+	">=": "__le__",
+}
+
+func init() {
+	object.InspectInstance = inspectInstance
+}
+
+// evalOperatorMethod : オペランドがインスタンスなら、演算子のメソッドを呼び出す
+//
+// 左のオペランドのメソッドを優先し、無ければ右のオペランドの反対の比較を使う
+// != は __eq__ の結果を反転する。メソッドが無ければ ok は false
+func evalOperatorMethod(
+	node ast.Node,
+	operator string,
+	left, right object.Object,
+	env *object.Environment,
+) (object.Object, bool) {
+	if operator == "!=" {
+		result, ok := evalOperatorMethod(node, "==", left, right, env)
+		if !ok || isError(result) {
+			return result, ok
+		}
+		return nativeBoolToBooleanObject(!isTruthy(result)), true
+	}
+
+	if inst, ok := left.(*object.Instance); ok {
+		if result, ok := callMethod(inst, operatorMethods[operator], []object.Object{right}, node, env); ok {
+			return result, true
+		}
+	}
+	if inst, ok := right.(*object.Instance); ok {
+		if result, ok := callMethod(inst, reflectedMethods[operator], []object.Object{left}, node, env); ok {
+			return result, true
+		}
+	}
+	return nil, false
+}
+
+// callMethod : inst のメソッド name を呼び出す、メソッドが無ければ ok は false
+//
+// node は呼び出し履歴に記録する位置で、nil でもよい
+func callMethod(
+	inst *object.Instance,
+	name string,
+	args []object.Object,
+	node ast.Node,
+	env *object.Environment,
+) (object.Object, bool) {
+	if name == "" {
+		return nil, false
+	}
+	_, ref, _ := lookupMember(inst, name)
+	if ref == nil {
+		return nil, false
+	}
+
+	method := ref.Value()
+	if fn, ok := method.(*object.Function); ok {
+		method = &object.BoundMethod{Receiver: inst, Function: fn}
+	}
+
+	var pos token.Position
+	if node != nil {
+		pos = node.Pos()
+	}
+	return invoke(name, pos, method, args, env), true
+}
+
+// stringify : 連結や埋め込み式で使う文字列表現
+//
+// String の Inspect は引用符を付けない値そのもの。インスタンスは __str__ があればそれを使う
+func stringify(obj object.Object, env *object.Environment) (string, *object.Error) {
+	inst, ok := obj.(*object.Instance)
+	if !ok {
+		return obj.Inspect(), nil
+	}
+
+	result, ok := callMethod(inst, "__str__", nil, nil, env)
+	if !ok {
+		return obj.Inspect(), nil
+	}
+	if err, ok := result.(*object.Error); ok {
+		return "", err
+	}
+	str, ok := result.(*object.String)
+	if !ok {
+		return "", newError(object.TYPE_ERROR, "__str__ of %s must return STRING, got %s",
+			inst.Class.Name.Value, result.Type())
+	}
+	return str.Value, nil
+}
+
+// inspectInstance : object.Instance.Inspect から __str__ を呼び出す
+//
+// Inspect はエラーを返せないので、__str__ がエラーになった場合は既定の表現にする
+// Inspect は Eval が戻った後 (REPL の表示や puts) にも呼ばれるので、Go の panic もここで止める
+// (自分自身を Inspect した場合に止めるのは Instance.Inspect)
+func inspectInstance(inst *object.Instance) (str string, ok bool) {
+	defer func() {
+		if r := recover(); r != nil {
+			str, ok = "", false
+		}
+	}()
+
+	str, err := stringify(inst, nil)
+	if err != nil {
+		return "", false
+	}
+	return str, true
+}
+
+// hashKey : ハッシュのキーを求める、インスタンスは __hash__ の結果をキーにする
+func hashKey(key object.Object, env *object.Environment) (object.HashKey, *object.Error) {
+	if inst, ok := key.(*object.Instance); ok {
+		result, ok := callMethod(inst, "__hash__", nil, nil, env)
+		if !ok {
+			return object.HashKey{}, newError(object.TYPE_ERROR, "unusable as hash key: %s", key.Type())
+		}
+		if err, ok := result.(*object.Error); ok {
+			return object.HashKey{}, err
+		}
+		hashable, ok := result.(object.Hashable)
+		if !ok || isNaN(result) {
+			return object.HashKey{}, newError(object.TYPE_ERROR, "__hash__ of %s must return a hashable value, got %s",
+				inst.Class.Name.Value, result.Type())
+		}
+		// 同じ値を返すインスタンス同士は同じキーになるが、その値そのものとは区別する
+		return object.HashKey{Type: object.INSTANCE_OBJ, Value: hashable.HashKey().Value}, nil
+	}
+
+	hashable, ok := key.(object.Hashable)
+	if !ok || isNaN(key) {
+		return object.HashKey{}, newError(object.TYPE_ERROR, "unusable as hash key: %s", key.Type())
+	}
+	return hashable.HashKey(), nil
+}
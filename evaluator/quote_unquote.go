@@ -29,7 +29,7 @@ func evalUnquoteCalls(quoted ast.Node, env *object.Environment) ast.Node {
 		}
 
 		// 呼び出し
-		unquoted := Eval(call.Arguments[0], env)
+		unquoted := eval(call.Arguments[0], env)
 		return convertObjectToASTNode(unquoted)
 	})
 }
@@ -53,6 +53,13 @@ func convertObjectToASTNode(obj object.Object) ast.Node {
 		}
 		return &ast.IntegerLiteral{Token: t, Value: obj.Value}
 
+	case *object.Float:
+		t := token.Token{
+			Type:    token.FLOAT,
+			Literal: obj.Inspect(),
+		}
+		return &ast.FloatLiteral{Token: t, Value: obj.Value}
+
 	case *object.Boolean:
 		var t token.Token
 		if obj.Value {
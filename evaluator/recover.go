@@ -0,0 +1,98 @@
+package evaluator
+
+import (
+	"github.com/CHIKUWAODEN/monkey-for-c95/ast"
+	"github.com/CHIKUWAODEN/monkey-for-c95/object"
+	"github.com/CHIKUWAODEN/monkey-for-c95/token"
+)
+
+// runtimePanic : Go の panic を、起きた時点の呼び出し履歴と一緒に運ぶ
+type runtimePanic struct {
+	value  interface{}
+	frames []object.Frame // 内側の呼び出しが先頭
+}
+
+// 関数呼び出しを評価する
+//
+// 呼び出し元の環境 env から呼び出し履歴をたどり、この呼び出しの frame を積む
+// 呼び出しが深すぎる場合は "stack overflow" のエラーにする
+// 評価中にエラーになった場合や panic が起きた場合は、呼び出し履歴を記録する
+func callFunction(
+	node *ast.CallExpression,
+	fn object.Object,
+	args []object.Object,
+	env *object.Environment,
+) object.Object {
+	return invoke(callee(node, fn), node.Pos(), fn, args, env)
+}
+
+// invoke : 呼び出し式が無い関数呼び出し (演算子のメソッドなど) も含めて、name という frame で fn を呼び出す
+//
+// env が nil なら呼び出し履歴の一番外側の呼び出しになる
+func invoke(
+	name string,
+	pos token.Position,
+	fn object.Object,
+	args []object.Object,
+	env *object.Environment,
+) object.Object {
+	frame := &object.CallFrame{
+		Frame:  object.Frame{Function: name, Pos: pos},
+		Caller: env.CallFrame(),
+		Depth:  1,
+	}
+	if frame.Caller != nil {
+		frame.Depth = frame.Caller.Depth + 1
+	}
+	if frame.Depth > MaxCallDepth {
+		err := newError(object.RECURSION_ERROR, "stack overflow")
+		err.Stack = frame.Trace()
+		return err
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			rp, ok := r.(*runtimePanic)
+			if !ok {
+				rp = &runtimePanic{value: r, frames: frame.Trace()}
+			}
+			panic(rp)
+		}
+	}()
+
+	return withStack(applyFunction(fn, args, frame), frame)
+}
+
+// エラーに呼び出し履歴が無ければ、frame からの履歴を付ける
+func withStack(obj object.Object, frame *object.CallFrame) object.Object {
+	if err, ok := obj.(*object.Error); ok && err.Stack == nil {
+		err.Stack = frame.Trace()
+	}
+	return obj
+}
+
+// 呼び出し履歴に表示する関数名、名前の無い関数は呼び出し式で示す
+func callee(node *ast.CallExpression, fn object.Object) string {
+	if bm, ok := fn.(*object.BoundMethod); ok {
+		fn = bm.Function
+	}
+	if fn, ok := fn.(*object.Function); ok && fn.Name != "" {
+		return fn.Name
+	}
+	return node.Function.String()
+}
+
+// recover した値を object.Error に変換する
+func panicToError(r interface{}) *object.Error {
+	rp, ok := r.(*runtimePanic)
+	if !ok {
+		rp = &runtimePanic{value: r}
+	}
+
+	err := newError(object.INTERNAL_ERROR, "internal error: %v", rp.value)
+	err.Stack = rp.frames
+	if len(rp.frames) > 0 {
+		err.Pos = rp.frames[0].Pos
+	}
+	return err
+}
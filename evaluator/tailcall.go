@@ -0,0 +1,53 @@
+package evaluator
+
+import (
+	"github.com/CHIKUWAODEN/monkey-for-c95/ast"
+	"github.com/CHIKUWAODEN/monkey-for-c95/object"
+)
+
+// tailCall : 末尾位置の呼び出しを、呼び出さずに applyUserFunction まで持ち帰るための値
+//
+// 関数本体の評価結果としてのみ現れ、Monkey のプログラムからは見えない
+type tailCall struct {
+	node *ast.CallExpression
+	fn   *object.Function
+	this *object.Instance // メソッド呼び出しなら this に束縛するインスタンス
+	args []object.Object
+}
+
+func (tc *tailCall) Type() object.ObjectType { return "TAIL_CALL" }
+func (tc *tailCall) Inspect() string         { return "tail call " + tc.node.String() }
+
+// applyUserFunction : 関数本体を評価する
+//
+// 本体の評価結果が末尾呼び出しであれば、Go のスタックを積まずにループで次の関数を評価する
+// (トランポリン)。再帰で書かれたループも一定のスタックで実行できる
+// 末尾呼び出しは呼び出し履歴の中で呼び出し元の frame を書き換えて置き換える
+func applyUserFunction(
+	fn *object.Function,
+	this *object.Instance,
+	args []object.Object,
+	frame *object.CallFrame,
+) object.Object {
+	var site *ast.CallExpression
+
+	for {
+		extendedEnv, err := extendedFunctionEnv(fn, this, args, frame)
+		if err != nil {
+			if site != nil && !err.Pos.IsValid() {
+				err.Pos = site.Pos()
+			}
+			return withStack(err, frame)
+		}
+
+		evaluated := unwrapReturnValue(eval(fn.Body, extendedEnv))
+
+		tc, ok := evaluated.(*tailCall)
+		if !ok {
+			return withStack(evaluated, frame)
+		}
+		site, fn, this, args = tc.node, tc.fn, tc.this, tc.args
+		// invoke が panic 時に記録する frame も同じものなので、新しく作らずに書き換える
+		frame.Frame = object.Frame{Function: callee(tc.node, tc.fn), Pos: tc.node.Pos()}
+	}
+}
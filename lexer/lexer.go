@@ -1,55 +1,122 @@
 package lexer
 
 import (
+	"errors"
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
 	"github.com/CHIKUWAODEN/monkey-for-c95/token"
 )
 
 // Lexer : lexing input source
 type Lexer struct {
 	input        string
+	filename     string
 	position     int  // current position on input (point to current character)
 	readPosition int  // position to read (next character from current position)
-	ch           byte // current character
+	ch           rune // current character
+	line         int  // line of current character
+	column       int  // column of current character, counted in runes
+	mode         Mode
+	templates    []int // brace depth inside each open string interpolation "${ ... }"
 }
 
+// Mode : controls the lexer behavior
+type Mode uint
+
+const (
+	// ScanComments : return comments as token.COMMENT instead of skipping them
+	ScanComments Mode = 1 << iota
+)
+
 // New : create a new Lexer instance
 func New(input string) *Lexer {
+	return NewWithFile("", input)
+}
+
+// NewWithFile : create a new Lexer instance, positions of tokens carry the filename
+func NewWithFile(filename string, input string) *Lexer {
 	l := &Lexer{
-		input: input,
+		input:    input,
+		filename: filename,
+		line:     1,
 	}
 	l.readChar()
 	return l
 }
 
-// read a character from input
-//
-// [todo] - support UTF-8
+// read a character (UTF-8 encoded rune) from input
 func (l *Lexer) readChar() {
 
+	// advance line / column of the character we are leaving
+	if l.ch == '\n' {
+		l.line++
+		l.column = 1
+	} else {
+		l.column++
+	}
+
 	// check EOF
+	width := 1
 	if l.readPosition >= len(l.input) {
 		l.ch = 0
 	} else {
-		l.ch = l.input[l.readPosition]
+		// 不正なバイト列は utf8.RuneError (U+FFFD) として読み進める
+		l.ch, width = utf8.DecodeRuneInString(l.input[l.readPosition:])
 	}
 	l.position = l.readPosition
-	l.readPosition++
+	l.readPosition += width
 }
 
 // peekChar : peek next character
-func (l *Lexer) peekChar() byte {
+func (l *Lexer) peekChar() rune {
 	if l.readPosition >= len(l.input) {
 		return 0
 	} else {
-		return l.input[l.readPosition]
+		ch, _ := utf8.DecodeRuneInString(l.input[l.readPosition:])
+		return ch
+	}
+}
+
+// SetMode : change the lexer mode
+func (l *Lexer) SetMode(mode Mode) {
+	l.mode = mode
+}
+
+// pos : position of current character
+func (l *Lexer) pos() token.Position {
+	return token.Position{
+		Filename: l.filename,
+		Offset:   l.position,
+		Line:     l.line,
+		Column:   l.column,
 	}
 }
 
 // NextToken : get a next token
 func (l *Lexer) NextToken() token.Token {
-	var tok token.Token
+	for {
+		l.skipWhiteSplace()
 
-	l.skipWhiteSplace()
+		pos := l.pos()
+		tok := l.nextToken()
+		tok.Pos = pos
+		tok.End = l.pos()
+		if tok.Type == token.EOF {
+			tok.End = pos
+		}
+
+		if tok.Type == token.COMMENT && l.mode&ScanComments == 0 {
+			continue
+		}
+		return tok
+	}
+}
+
+func (l *Lexer) nextToken() token.Token {
+	var tok token.Token
 
 	switch l.ch {
 	case '=':
@@ -71,17 +138,74 @@ func (l *Lexer) NextToken() token.Token {
 			tok = newToken(token.BANG, l.ch)
 		}
 	case '+':
-		tok = newToken(token.PLUS, l.ch)
+		if l.peekChar() == '=' {
+			tok = l.newTwoCharToken(token.PLUS_ASSIGN) // "+="
+		} else {
+			tok = newToken(token.PLUS, l.ch)
+		}
 	case '-':
-		tok = newToken(token.MINUS, l.ch)
+		if l.peekChar() == '=' {
+			tok = l.newTwoCharToken(token.MINUS_ASSIGN) // "-="
+		} else {
+			tok = newToken(token.MINUS, l.ch)
+		}
 	case '/':
-		tok = newToken(token.SLASH, l.ch)
+		if l.peekChar() == '/' {
+			tok = token.Token{Type: token.COMMENT, Literal: l.readLineComment()}
+		} else if l.peekChar() == '*' {
+			comment, err := l.readBlockComment()
+			if err != nil {
+				tok = token.Token{Type: token.ILLEGAL, Literal: err.Error()}
+			} else {
+				tok = token.Token{Type: token.COMMENT, Literal: comment}
+			}
+		} else if l.peekChar() == '=' {
+			tok = l.newTwoCharToken(token.SLASH_ASSIGN) // "/="
+		} else {
+			tok = newToken(token.SLASH, l.ch)
+		}
 	case '*':
-		tok = newToken(token.ASTERISK, l.ch)
+		if l.peekChar() == '*' {
+			tok = l.newTwoCharToken(token.POWER) // "**"
+		} else if l.peekChar() == '=' {
+			tok = l.newTwoCharToken(token.ASTERISK_ASSIGN) // "*="
+		} else {
+			tok = newToken(token.ASTERISK, l.ch)
+		}
+	case '%':
+		tok = newToken(token.PERCENT, l.ch)
+	case '&':
+		if l.peekChar() == '&' {
+			tok = l.newTwoCharToken(token.AND) // "&&"
+		} else {
+			tok = newToken(token.AMPERSAND, l.ch)
+		}
+	case '|':
+		if l.peekChar() == '|' {
+			tok = l.newTwoCharToken(token.OR) // "||"
+		} else {
+			tok = newToken(token.PIPE, l.ch)
+		}
+	case '^':
+		tok = newToken(token.CARET, l.ch)
+	case '~':
+		tok = newToken(token.TILDE, l.ch)
 	case '<':
-		tok = newToken(token.LT, l.ch)
+		if l.peekChar() == '<' {
+			tok = l.newTwoCharToken(token.SHL) // "<<"
+		} else if l.peekChar() == '=' {
+			tok = l.newTwoCharToken(token.LTEQ) // "<="
+		} else {
+			tok = newToken(token.LT, l.ch)
+		}
 	case '>':
-		tok = newToken(token.GT, l.ch)
+		if l.peekChar() == '>' {
+			tok = l.newTwoCharToken(token.SHR) // ">>"
+		} else if l.peekChar() == '=' {
+			tok = l.newTwoCharToken(token.GTEQ) // ">="
+		} else {
+			tok = newToken(token.GT, l.ch)
+		}
 	case ';':
 		tok = newToken(token.SEMICOLON, l.ch)
 	case ':':
@@ -93,18 +217,43 @@ func (l *Lexer) NextToken() token.Token {
 	case ',':
 		tok = newToken(token.COMMA, l.ch)
 	case '{':
+		if n := len(l.templates); n > 0 {
+			l.templates[n-1]++
+		}
 		tok = newToken(token.LBRACE, l.ch)
 	case '}':
-		tok = newToken(token.RBRACE, l.ch)
+		n := len(l.templates)
+		if n > 0 && l.templates[n-1] == 0 {
+			// 埋め込み式の終わり、文字列の続きを読む
+			l.templates = l.templates[:n-1]
+			tok = l.readTemplate(token.TEMPLATE_MIDDLE, token.TEMPLATE_TAIL)
+		} else {
+			if n > 0 {
+				l.templates[n-1]--
+			}
+			tok = newToken(token.RBRACE, l.ch)
+		}
 	case '[':
 		tok = newToken(token.LBRACKET, l.ch)
 	case ']':
 		tok = newToken(token.RBRACKET, l.ch)
 	case '"':
-		tok.Type = token.STRING
-		tok.Literal = l.readString()
+		tok = l.readTemplate(token.TEMPLATE_HEAD, token.STRING)
+	case '`':
+		str, err := l.readRawString()
+		if err != nil {
+			tok = token.Token{Type: token.ILLEGAL, Literal: err.Error()}
+		} else {
+			tok = token.Token{Type: token.STRING, Literal: str}
+		}
 	case '.':
-		tok = newToken(token.DOT, l.ch)
+		if strings.HasPrefix(l.input[l.position:], "...") {
+			l.readChar()
+			l.readChar()
+			tok = token.Token{Type: token.ELLIPSIS, Literal: "..."}
+		} else {
+			tok = newToken(token.DOT, l.ch)
+		}
 
 	case 0:
 		tok.Literal = ""
@@ -115,8 +264,7 @@ func (l *Lexer) NextToken() token.Token {
 			tok.Type = token.LookupIdent(tok.Literal)
 			return tok
 		} else if isDigit(l.ch) {
-			tok.Type = token.INT
-			tok.Literal = l.readNumber()
+			tok.Type, tok.Literal = l.readNumber()
 			return tok
 		} else {
 			tok = newToken(token.ILLEGAL, l.ch)
@@ -127,13 +275,23 @@ func (l *Lexer) NextToken() token.Token {
 }
 
 // create a new Token
-func newToken(tokenType token.TokenType, ch byte) token.Token {
+func newToken(tokenType token.TokenType, ch rune) token.Token {
 	return token.Token{
 		Type:    tokenType,
 		Literal: string(ch),
 	}
 }
 
+// create a new Token from current and next character
+func (l *Lexer) newTwoCharToken(tokenType token.TokenType) token.Token {
+	ch := l.ch
+	l.readChar()
+	return token.Token{
+		Type:    tokenType,
+		Literal: string(ch) + string(l.ch),
+	}
+}
+
 // read a identifier string
 func (l *Lexer) readIdentifier() string {
 	position := l.position
@@ -143,23 +301,208 @@ func (l *Lexer) readIdentifier() string {
 	return l.input[position:l.position]
 }
 
-func (l *Lexer) readNumber() string {
+// read an integer (123, 0xFF, 0o755, 0b1010, 1_000) or
+// a float (3.14, 1e-9, 0.5) literal
+//
+// 数字の区切り文字 '_' の位置の妥当性は parser (strconv) で検査する
+func (l *Lexer) readNumber() (token.TokenType, string) {
 	position := l.position
-	for isDigit(l.ch) {
+	tokenType := token.TokenType(token.INT)
+
+	if l.ch == '0' {
+		switch l.peekChar() {
+		case 'x', 'X', 'o', 'O', 'b', 'B':
+			// 基数に合わない数字 (0b102 など) もまとめて読み、parser でエラーにする
+			l.readChar()
+			l.readChar()
+			l.readDigits(isHexDigit)
+			return tokenType, l.input[position:l.position]
+		}
+	}
+
+	l.readDigits(isDigit)
+
+	// "1.foo" のようなドット演算子と区別するため、小数点の後には数字が必要
+	if l.ch == '.' && isDigit(l.peekChar()) {
+		tokenType = token.FLOAT
 		l.readChar()
+		l.readDigits(isDigit)
 	}
-	return l.input[position:l.position]
+
+	if l.ch == 'e' || l.ch == 'E' {
+		tokenType = token.FLOAT
+		l.readChar()
+		if l.ch == '+' || l.ch == '-' {
+			l.readChar()
+		}
+		if !isDigit(l.ch) {
+			return token.ILLEGAL, "malformed exponent in number literal: " +
+				l.input[position:l.position]
+		}
+		l.readDigits(isDigit)
+	}
+
+	return tokenType, l.input[position:l.position]
 }
 
-func (l *Lexer) readString() string {
+// read digits and '_' separators
+func (l *Lexer) readDigits(isBaseDigit func(rune) bool) {
+	for isBaseDigit(l.ch) || l.ch == '_' {
+		l.readChar()
+	}
+}
+
+// read a part of a double-quoted string, the token is open if it ends at "${"
+// and closed if it ends at the closing quote
+//
+// "${" で終わった場合は埋め込み式の入れ子を記録し、対応する '}' から続きを読む
+func (l *Lexer) readTemplate(open, closed token.TokenType) token.Token {
+	str, interpolation, err := l.readString()
+	if interpolation {
+		l.templates = append(l.templates, 0)
+	}
+	if err != nil {
+		return token.Token{Type: token.ILLEGAL, Literal: err.Error()}
+	}
+	if interpolation {
+		return token.Token{Type: open, Literal: str}
+	}
+	return token.Token{Type: closed, Literal: str}
+}
+
+// read a double-quoted string, interpreting escape sequences,
+// until the closing quote or the beginning of an interpolation "${"
+//
+// エラーがあっても閉じ引用符までは読み進めて、後続のトークンがずれないようにする
+func (l *Lexer) readString() (string, bool, error) {
+	var out strings.Builder
+	var err error
+
+	for {
+		l.readChar()
+		switch l.ch {
+		case '"':
+			return out.String(), false, err
+		case '$':
+			if l.peekChar() == '{' {
+				l.readChar()
+				return out.String(), true, err
+			}
+			out.WriteRune(l.ch)
+		case 0:
+			return "", false, errors.New("unterminated string literal")
+		case '\\':
+			l.readChar()
+			ch, escErr := l.readEscape()
+			if escErr == nil {
+				out.WriteRune(ch)
+				continue
+			}
+			if err == nil {
+				err = escErr
+			}
+			// 不正なエスケープの読み取り中に文字列の終端に達した
+			if l.ch == '"' {
+				return "", false, err
+			}
+			if l.ch == 0 {
+				return "", false, errors.New("unterminated string literal")
+			}
+		default:
+			out.WriteRune(l.ch)
+		}
+	}
+}
+
+// read the character following a backslash
+func (l *Lexer) readEscape() (rune, error) {
+	switch l.ch {
+	case 'n':
+		return '\n', nil
+	case 't':
+		return '\t', nil
+	case 'r':
+		return '\r', nil
+	case '0':
+		return 0, nil
+	case '"':
+		return '"', nil
+	case '\\':
+		return '\\', nil
+	case '$':
+		return '$', nil
+	case 'u':
+		return l.readUnicodeEscape()
+	case 0:
+		return 0, errors.New("unterminated string literal")
+	default:
+		return 0, fmt.Errorf("unknown escape sequence: \\%c", l.ch)
+	}
+}
+
+// read \u{XXXX}, current character is 'u'
+func (l *Lexer) readUnicodeEscape() (rune, error) {
+	if l.peekChar() != '{' {
+		return 0, errors.New("invalid unicode escape: expected '{' after \\u")
+	}
+	l.readChar()
+
+	var value rune
+	digits := 0
+	for l.peekChar() != '}' {
+		l.readChar()
+		d, ok := hexValue(l.ch)
+		if !ok || digits >= 6 {
+			return 0, errors.New("invalid unicode escape")
+		}
+		value = value*16 + d
+		digits++
+	}
+	l.readChar() // '}'
+
+	if digits == 0 || !utf8.ValidRune(value) {
+		return 0, errors.New("invalid unicode escape")
+	}
+	return value, nil
+}
+
+// read a raw string enclosed in backquotes, it may span multiple lines
+func (l *Lexer) readRawString() (string, error) {
 	position := l.position + 1
 	for {
 		l.readChar()
-		if l.ch == '"' || l.ch == 0 {
-			break
+		if l.ch == '`' {
+			return l.input[position:l.position], nil
+		}
+		if l.ch == 0 {
+			return "", errors.New("unterminated raw string literal")
+		}
+	}
+}
+
+// read "// ..." up to (not including) the end of line
+func (l *Lexer) readLineComment() string {
+	position := l.position
+	for l.peekChar() != '\n' && l.peekChar() != 0 {
+		l.readChar()
+	}
+	return l.input[position:l.readPosition]
+}
+
+// read "/* ... */", block comments do not nest
+func (l *Lexer) readBlockComment() (string, error) {
+	position := l.position
+	l.readChar() // '*'
+	for {
+		l.readChar()
+		if l.ch == 0 {
+			return "", errors.New("unterminated block comment")
+		}
+		if l.ch == '*' && l.peekChar() == '/' {
+			l.readChar()
+			return l.input[position:l.readPosition], nil
 		}
 	}
-	return l.input[position:l.position]
 }
 
 // skipping white-space-character
@@ -170,10 +513,28 @@ func (l *Lexer) skipWhiteSplace() {
 }
 
 // judge a character is letter-character or non-letter-character
-func isLetter(ch byte) bool {
-	return 'a' <= ch && ch <= 'z' || 'A' <= ch && ch <= 'Z' || ch == '_'
+func isLetter(ch rune) bool {
+	return 'a' <= ch && ch <= 'z' || 'A' <= ch && ch <= 'Z' || ch == '_' ||
+		ch >= utf8.RuneSelf && unicode.IsLetter(ch)
+}
+
+func hexValue(ch rune) (rune, bool) {
+	switch {
+	case '0' <= ch && ch <= '9':
+		return ch - '0', true
+	case 'a' <= ch && ch <= 'f':
+		return ch - 'a' + 10, true
+	case 'A' <= ch && ch <= 'F':
+		return ch - 'A' + 10, true
+	}
+	return 0, false
+}
+
+func isHexDigit(ch rune) bool {
+	_, ok := hexValue(ch)
+	return ok
 }
 
-func isDigit(ch byte) bool {
+func isDigit(ch rune) bool {
 	return '0' <= ch && ch <= '9'
 }
@@ -17,7 +17,7 @@ let add = fn(x, y) {
 
 let result = add(five, ten);
 
-!-/*5;
+!-/ *5;
 5 < 10 > 5;
 
 if (5 < 10) {
@@ -161,6 +161,7 @@ macro(x, y) { x + y; };
 func TestNextTokenForClass(t *testing.T) {
 	input := `
 class Foo {};
+class Bar extends Foo { super(); };
 `
 
 	tests := []struct {
@@ -172,6 +173,409 @@ class Foo {};
 		{token.LBRACE, "{"},
 		{token.RBRACE, "}"},
 		{token.SEMICOLON, ";"},
+		{token.CLASS, "class"},
+		{token.IDENT, "Bar"},
+		{token.EXTENDS, "extends"},
+		{token.IDENT, "Foo"},
+		{token.LBRACE, "{"},
+		{token.SUPER, "super"},
+		{token.LPAREN, "("},
+		{token.RPAREN, ")"},
+		{token.SEMICOLON, ";"},
+		{token.RBRACE, "}"},
+		{token.SEMICOLON, ";"},
+		{token.EOF, ""},
+	}
+
+	l := New(input)
+
+	for i, tt := range tests {
+		tok := l.NextToken()
+
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q",
+				i, tt.expectedType, tok.Type)
+		}
+
+		if tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - literal wrong. expected=%q, got=%q",
+				i, tt.expectedLiteral, tok.Literal)
+		}
+	}
+}
+
+func TestNextTokenPosition(t *testing.T) {
+	input := `let x = 5;
+  x + "ab";
+`
+
+	tests := []struct {
+		expectedType token.TokenType
+		expectedPos  token.Position
+		expectedEnd  token.Position
+	}{
+		{token.LET, token.Position{Filename: "test.mk", Offset: 0, Line: 1, Column: 1}, token.Position{Filename: "test.mk", Offset: 3, Line: 1, Column: 4}},
+		{token.IDENT, token.Position{Filename: "test.mk", Offset: 4, Line: 1, Column: 5}, token.Position{Filename: "test.mk", Offset: 5, Line: 1, Column: 6}},
+		{token.ASSIGN, token.Position{Filename: "test.mk", Offset: 6, Line: 1, Column: 7}, token.Position{Filename: "test.mk", Offset: 7, Line: 1, Column: 8}},
+		{token.INT, token.Position{Filename: "test.mk", Offset: 8, Line: 1, Column: 9}, token.Position{Filename: "test.mk", Offset: 9, Line: 1, Column: 10}},
+		{token.SEMICOLON, token.Position{Filename: "test.mk", Offset: 9, Line: 1, Column: 10}, token.Position{Filename: "test.mk", Offset: 10, Line: 1, Column: 11}},
+		{token.IDENT, token.Position{Filename: "test.mk", Offset: 13, Line: 2, Column: 3}, token.Position{Filename: "test.mk", Offset: 14, Line: 2, Column: 4}},
+		{token.PLUS, token.Position{Filename: "test.mk", Offset: 15, Line: 2, Column: 5}, token.Position{Filename: "test.mk", Offset: 16, Line: 2, Column: 6}},
+		{token.STRING, token.Position{Filename: "test.mk", Offset: 17, Line: 2, Column: 7}, token.Position{Filename: "test.mk", Offset: 21, Line: 2, Column: 11}},
+		{token.SEMICOLON, token.Position{Filename: "test.mk", Offset: 21, Line: 2, Column: 11}, token.Position{Filename: "test.mk", Offset: 22, Line: 2, Column: 12}},
+		{token.EOF, token.Position{Filename: "test.mk", Offset: 23, Line: 3, Column: 1}, token.Position{Filename: "test.mk", Offset: 23, Line: 3, Column: 1}},
+	}
+
+	l := NewWithFile("test.mk", input)
+
+	for i, tt := range tests {
+		tok := l.NextToken()
+
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q",
+				i, tt.expectedType, tok.Type)
+		}
+
+		if tok.Pos != tt.expectedPos {
+			t.Fatalf("tests[%d] - pos wrong. expected=%+v, got=%+v",
+				i, tt.expectedPos, tok.Pos)
+		}
+
+		if tok.End != tt.expectedEnd {
+			t.Fatalf("tests[%d] - end wrong. expected=%+v, got=%+v",
+				i, tt.expectedEnd, tok.End)
+		}
+	}
+}
+
+func TestNextTokenUTF8(t *testing.T) {
+	input := `let 値段 = "¥100 です";
+値段_税込;`
+
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+		expectedColumn  int
+	}{
+		{token.LET, "let", 1},
+		{token.IDENT, "値段", 5},
+		{token.ASSIGN, "=", 8},
+		{token.STRING, "¥100 です", 10},
+		{token.SEMICOLON, ";", 19},
+		{token.IDENT, "値段_税込", 1},
+		{token.SEMICOLON, ";", 6},
+		{token.EOF, "", 7},
+	}
+
+	l := New(input)
+
+	for i, tt := range tests {
+		tok := l.NextToken()
+
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q",
+				i, tt.expectedType, tok.Type)
+		}
+
+		if tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - literal wrong. expected=%q, got=%q",
+				i, tt.expectedLiteral, tok.Literal)
+		}
+
+		if tok.Pos.Column != tt.expectedColumn {
+			t.Fatalf("tests[%d] - column wrong. expected=%d, got=%d",
+				i, tt.expectedColumn, tok.Pos.Column)
+		}
+	}
+}
+
+func TestNextTokenString(t *testing.T) {
+	tests := []struct {
+		input           string
+		expectedType    token.TokenType
+		expectedLiteral string
+	}{
+		{`"a\nb"`, token.STRING, "a\nb"},
+		{`"\t\r\0"`, token.STRING, "\t\r\x00"},
+		{`"say \"hi\""`, token.STRING, `say "hi"`},
+		{`"back\\slash"`, token.STRING, `back\slash`},
+		{`"cost: $5 \${x}"`, token.STRING, "cost: $5 ${x}"},
+		{`"\u{41}\u{5024}\u{1F600}"`, token.STRING, "A値😀"},
+		{"`raw\\n\n\"line\"`", token.STRING, "raw\\n\n\"line\""},
+		{`"abc`, token.ILLEGAL, "unterminated string literal"},
+		{`"abc\`, token.ILLEGAL, "unterminated string literal"},
+		{"`abc", token.ILLEGAL, "unterminated raw string literal"},
+		{`"a\qb"`, token.ILLEGAL, `unknown escape sequence: \q`},
+		{`"\u{}"`, token.ILLEGAL, "invalid unicode escape"},
+		{`"\u{110000}"`, token.ILLEGAL, "invalid unicode escape"},
+		{`"\u41"`, token.ILLEGAL, `invalid unicode escape: expected '{' after \u`},
+	}
+
+	for i, tt := range tests {
+		l := New(tt.input)
+		tok := l.NextToken()
+
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q",
+				i, tt.expectedType, tok.Type)
+		}
+
+		if tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - literal wrong. expected=%q, got=%q",
+				i, tt.expectedLiteral, tok.Literal)
+		}
+
+		if tok := l.NextToken(); tok.Type != token.EOF {
+			t.Fatalf("tests[%d] - expected EOF after string, got=%q", i, tok.Type)
+		}
+	}
+}
+
+func TestNextTokenTemplate(t *testing.T) {
+	input := `"a${x}b${ {"k": "${y}"}["k"] }c" "${}"`
+
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+	}{
+		{token.TEMPLATE_HEAD, "a"},
+		{token.IDENT, "x"},
+		{token.TEMPLATE_MIDDLE, "b"},
+		{token.LBRACE, "{"},
+		{token.STRING, "k"},
+		{token.COLON, ":"},
+		{token.TEMPLATE_HEAD, ""},
+		{token.IDENT, "y"},
+		{token.TEMPLATE_TAIL, ""},
+		{token.RBRACE, "}"},
+		{token.LBRACKET, "["},
+		{token.STRING, "k"},
+		{token.RBRACKET, "]"},
+		{token.TEMPLATE_TAIL, "c"},
+		{token.TEMPLATE_HEAD, ""},
+		{token.TEMPLATE_TAIL, ""},
+		{token.EOF, ""},
+	}
+
+	l := New(input)
+	for i, tt := range tests {
+		tok := l.NextToken()
+
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q",
+				i, tt.expectedType, tok.Type)
+		}
+
+		if tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - literal wrong. expected=%q, got=%q",
+				i, tt.expectedLiteral, tok.Literal)
+		}
+	}
+}
+
+func TestNextTokenStringPosition(t *testing.T) {
+	input := "let s = `a\nb`;\nlet t = \"oops"
+
+	l := New(input)
+	var tok token.Token
+	for tok = l.NextToken(); tok.Type != token.EOF; tok = l.NextToken() {
+		if tok.Type == token.ILLEGAL {
+			break
+		}
+	}
+
+	if tok.Type != token.ILLEGAL {
+		t.Fatalf("expected ILLEGAL token, got=%q", tok.Type)
+	}
+	if tok.Pos.Line != 3 || tok.Pos.Column != 9 {
+		t.Fatalf("wrong position of unterminated string. got=%s", tok.Pos)
+	}
+}
+
+func TestNextTokenComments(t *testing.T) {
+	input := `// leading comment
+let a = 1; // trailing
+/* block
+   comment */ a / 2;
+`
+
+	tests := []struct {
+		mode            Mode
+		expectedType    token.TokenType
+		expectedLiteral string
+	}{
+		{0, token.LET, "let"},
+		{0, token.IDENT, "a"},
+		{0, token.ASSIGN, "="},
+		{0, token.INT, "1"},
+		{0, token.SEMICOLON, ";"},
+		{0, token.IDENT, "a"},
+		{0, token.SLASH, "/"},
+		{0, token.INT, "2"},
+		{0, token.SEMICOLON, ";"},
+		{0, token.EOF, ""},
+		{ScanComments, token.COMMENT, "// leading comment"},
+		{ScanComments, token.LET, "let"},
+		{ScanComments, token.IDENT, "a"},
+		{ScanComments, token.ASSIGN, "="},
+		{ScanComments, token.INT, "1"},
+		{ScanComments, token.SEMICOLON, ";"},
+		{ScanComments, token.COMMENT, "// trailing"},
+		{ScanComments, token.COMMENT, "/* block\n   comment */"},
+		{ScanComments, token.IDENT, "a"},
+		{ScanComments, token.SLASH, "/"},
+		{ScanComments, token.INT, "2"},
+		{ScanComments, token.SEMICOLON, ";"},
+		{ScanComments, token.EOF, ""},
+	}
+
+	lexers := map[Mode]*Lexer{0: New(input), ScanComments: New(input)}
+	lexers[ScanComments].SetMode(ScanComments)
+
+	for i, tt := range tests {
+		tok := lexers[tt.mode].NextToken()
+
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q",
+				i, tt.expectedType, tok.Type)
+		}
+
+		if tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - literal wrong. expected=%q, got=%q",
+				i, tt.expectedLiteral, tok.Literal)
+		}
+	}
+}
+
+func TestUnterminatedBlockComment(t *testing.T) {
+	l := New("1 /* never closed")
+	l.NextToken()
+
+	tok := l.NextToken()
+	if tok.Type != token.ILLEGAL || tok.Literal != "unterminated block comment" {
+		t.Fatalf("expected unterminated block comment, got=%q (%q)",
+			tok.Type, tok.Literal)
+	}
+}
+
+func TestNextTokenNumber(t *testing.T) {
+	tests := []struct {
+		input           string
+		expectedType    token.TokenType
+		expectedLiteral string
+	}{
+		{"42", token.INT, "42"},
+		{"3.14", token.FLOAT, "3.14"},
+		{"0.5", token.FLOAT, "0.5"},
+		{"1e-9", token.FLOAT, "1e-9"},
+		{"2.5E+3", token.FLOAT, "2.5E+3"},
+		{"1e", token.ILLEGAL, "malformed exponent in number literal: 1e"},
+	}
+
+	for i, tt := range tests {
+		l := New(tt.input)
+		tok := l.NextToken()
+
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q",
+				i, tt.expectedType, tok.Type)
+		}
+
+		if tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - literal wrong. expected=%q, got=%q",
+				i, tt.expectedLiteral, tok.Literal)
+		}
+	}
+
+	// 小数点の後に数字がなければドット演算子
+	l := New("1.foo")
+	for _, expected := range []token.TokenType{token.INT, token.DOT, token.IDENT} {
+		if tok := l.NextToken(); tok.Type != expected {
+			t.Fatalf("tokentype wrong. expected=%q, got=%q", expected, tok.Type)
+		}
+	}
+}
+
+func TestNextTokenIntegerBase(t *testing.T) {
+	tests := []string{"0xFF", "0o755", "0b1010", "1_000_000", "0XdeadBEEF", "0b102"}
+
+	for i, input := range tests {
+		l := New(input)
+		tok := l.NextToken()
+
+		if tok.Type != token.INT {
+			t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q",
+				i, token.INT, tok.Type)
+		}
+
+		if tok.Literal != input {
+			t.Fatalf("tests[%d] - literal wrong. expected=%q, got=%q",
+				i, input, tok.Literal)
+		}
+	}
+}
+
+func TestNextTokenOperators(t *testing.T) {
+	input := `a % b ** c & d | e ^ ~f << 1 >> 2 * 3 < 4 > 5;
+a <= b >= c && d || e;
+a += 1 -= 2 *= 3 /= 4;
+f(...a.b);`
+
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+	}{
+		{token.IDENT, "a"},
+		{token.PERCENT, "%"},
+		{token.IDENT, "b"},
+		{token.POWER, "**"},
+		{token.IDENT, "c"},
+		{token.AMPERSAND, "&"},
+		{token.IDENT, "d"},
+		{token.PIPE, "|"},
+		{token.IDENT, "e"},
+		{token.CARET, "^"},
+		{token.TILDE, "~"},
+		{token.IDENT, "f"},
+		{token.SHL, "<<"},
+		{token.INT, "1"},
+		{token.SHR, ">>"},
+		{token.INT, "2"},
+		{token.ASTERISK, "*"},
+		{token.INT, "3"},
+		{token.LT, "<"},
+		{token.INT, "4"},
+		{token.GT, ">"},
+		{token.INT, "5"},
+		{token.SEMICOLON, ";"},
+		{token.IDENT, "a"},
+		{token.LTEQ, "<="},
+		{token.IDENT, "b"},
+		{token.GTEQ, ">="},
+		{token.IDENT, "c"},
+		{token.AND, "&&"},
+		{token.IDENT, "d"},
+		{token.OR, "||"},
+		{token.IDENT, "e"},
+		{token.SEMICOLON, ";"},
+		{token.IDENT, "a"},
+		{token.PLUS_ASSIGN, "+="},
+		{token.INT, "1"},
+		{token.MINUS_ASSIGN, "-="},
+		{token.INT, "2"},
+		{token.ASTERISK_ASSIGN, "*="},
+		{token.INT, "3"},
+		{token.SLASH_ASSIGN, "/="},
+		{token.INT, "4"},
+		{token.SEMICOLON, ";"},
+		{token.IDENT, "f"},
+		{token.LPAREN, "("},
+		{token.ELLIPSIS, "..."},
+		{token.IDENT, "a"},
+		{token.DOT, "."},
+		{token.IDENT, "b"},
+		{token.RPAREN, ")"},
+		{token.SEMICOLON, ";"},
 		{token.EOF, ""},
 	}
 
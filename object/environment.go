@@ -1,5 +1,14 @@
 package object
 
+import "errors"
+
+var (
+	// ErrUndefined : the name is not bound in any scope
+	ErrUndefined = errors.New("identifier not found")
+	// ErrConstant : the name is bound by const and can not be reassigned
+	ErrConstant = errors.New("cannot assign to constant")
+)
+
 func NewEnclosedEnvironment(outer *Environment) *Environment {
 	env := NewEnvironment()
 	env.outer = outer
@@ -8,12 +17,34 @@ func NewEnclosedEnvironment(outer *Environment) *Environment {
 
 func NewEnvironment() *Environment {
 	s := make(map[string]Object)
-	return &Environment{store: s}
+	c := make(map[string]bool)
+	return &Environment{store: s, constants: c}
 }
 
 type Environment struct {
-	store map[string]Object
-	outer *Environment
+	store     map[string]Object
+	constants map[string]bool // const で束縛された名前
+	outer     *Environment
+	frame     *CallFrame // この環境を作った関数呼び出し
+}
+
+// NewCallEnvironment : 関数呼び出し frame のための環境を作る
+func NewCallEnvironment(outer *Environment, frame *CallFrame) *Environment {
+	env := NewEnclosedEnvironment(outer)
+	env.frame = frame
+	return env
+}
+
+// CallFrame : この環境を評価している関数呼び出し、トップレベルなら nil
+//
+// ブロックの環境は関数呼び出しの環境を outer に持つので、それを探してたどる
+func (e *Environment) CallFrame() *CallFrame {
+	for env := e; env != nil; env = env.outer {
+		if env.frame != nil {
+			return env.frame
+		}
+	}
+	return nil
 }
 
 func (e *Environment) Get(name string) (Object, bool) {
@@ -24,7 +55,47 @@ func (e *Environment) Get(name string) (Object, bool) {
 	return obj, ok
 }
 
+// Set : bind name in this scope, regardless of existing bindings
 func (e *Environment) Set(name string, val Object) Object {
 	e.store[name] = val
 	return val
 }
+
+// Declare : bind a new name in this scope (let / const)
+//
+// 同じスコープですでに宣言されている名前の場合は false を返し、何もしない
+func (e *Environment) Declare(name string, val Object, constant bool) bool {
+	if _, ok := e.store[name]; ok {
+		return false
+	}
+	e.store[name] = val
+	if constant {
+		e.constants[name] = true
+	}
+	return true
+}
+
+// Assign : rebind name in the scope where it is defined
+func (e *Environment) Assign(name string, val Object) error {
+	for env := e; env != nil; env = env.outer {
+		if _, ok := env.store[name]; !ok {
+			continue
+		}
+		if env.constants[name] {
+			return ErrConstant
+		}
+		env.store[name] = val
+		return nil
+	}
+	return ErrUndefined
+}
+
+// IsConstant : report whether name resolves to a const binding
+func (e *Environment) IsConstant(name string) bool {
+	for env := e; env != nil; env = env.outer {
+		if _, ok := env.store[name]; ok {
+			return env.constants[name]
+		}
+	}
+	return false
+}
@@ -4,9 +4,14 @@ import (
 	"bytes"
 	"fmt"
 	"hash/fnv"
+	"math"
+	"sort"
+	"strconv"
 	"strings"
+	"unicode/utf8"
 
 	"github.com/CHIKUWAODEN/monkey-for-c95/ast"
+	"github.com/CHIKUWAODEN/monkey-for-c95/token"
 )
 
 type ObjectType string
@@ -16,12 +21,19 @@ const (
 	CLASS_OBJ        = "CLASS"
 	INSTANCE_OBJ     = "INSTANCE"
 	THIS_OBJ         = "THIS"
+	SUPER_OBJ        = "SUPER"
+	BOUND_METHOD_OBJ = "BOUND_METHOD"
 	INTEGER_OBJ      = "INTEGER"
+	FLOAT_OBJ        = "FLOAT"
 	STRING_OBJ       = "STRING"
 	BOOLEAN_OBJ      = "BOOLEAN"
 	NULL_OBJ         = "NULL"
 	RETURN_VALUE_OBJ = "RETURN_VALUE"
+	BREAK_OBJ        = "BREAK"
+	CONTINUE_OBJ     = "CONTINUE"
+	RANGE_OBJ        = "RANGE"
 	ERROR_OBJ        = "ERROR"
+	ERROR_VALUE_OBJ  = "ERROR_VALUE"
 	BUILTIN_OBJ      = "BUILTIN"
 	ARRAY_OBJ        = "ARRAY"
 	HASH_OBJ         = "HASH"
@@ -48,6 +60,22 @@ func (i *Integer) Type() ObjectType { return INTEGER_OBJ }
 
 /*---------------------------------------------------------------------------*/
 
+type Float struct {
+	Value float64
+}
+
+func (f *Float) Type() ObjectType { return FLOAT_OBJ }
+func (f *Float) Inspect() string {
+	str := strconv.FormatFloat(f.Value, 'g', -1, 64)
+	// 整数値の場合でも Float であることがわかるように小数点を付ける
+	if !strings.ContainsAny(str, ".eIN") {
+		str += ".0"
+	}
+	return str
+}
+
+/*---------------------------------------------------------------------------*/
+
 type String struct {
 	Value string
 }
@@ -55,6 +83,9 @@ type String struct {
 func (s *String) Type() ObjectType { return STRING_OBJ }
 func (s *String) Inspect() string  { return s.Value }
 
+// RuneLen : length of the string counted in runes (not bytes)
+func (s *String) RuneLen() int { return utf8.RuneCountInString(s.Value) }
+
 /*---------------------------------------------------------------------------*/
 
 type Boolean struct {
@@ -82,17 +113,193 @@ func (rv *ReturnValue) Inspect() string  { return rv.Value.Inspect() }
 
 /*---------------------------------------------------------------------------*/
 
+// Break : ループを抜けるためのシグナル、ReturnValue と同様に BlockStatement の評価を浮上していく
+type Break struct{}
+
+func (b *Break) Type() ObjectType { return BREAK_OBJ }
+func (b *Break) Inspect() string  { return "break" }
+
+/*---------------------------------------------------------------------------*/
+
+// Continue : ループの次の繰り返しに進むためのシグナル
+type Continue struct{}
+
+func (c *Continue) Type() ObjectType { return CONTINUE_OBJ }
+func (c *Continue) Inspect() string  { return "continue" }
+
+/*---------------------------------------------------------------------------*/
+
+// Range : Start から End の手前まで Step ずつ進む整数の列
+//
+// 配列と違い要素を保持しないため、大きな範囲でもメモリを消費しない
+type Range struct {
+	Start int64
+	End   int64
+	Step  int64 // 0 以外
+}
+
+func (r *Range) Type() ObjectType { return RANGE_OBJ }
+func (r *Range) Inspect() string {
+	return fmt.Sprintf("range(%d, %d, %d)", r.Start, r.End, r.Step)
+}
+
+// Len : number of integers in the range
+//
+// End - Start は int64 で桁あふれすることがあるので uint64 で計算する
+// 要素数が int64 に収まらない場合は負の値になる
+func (r *Range) Len() int64 {
+	var span, step uint64
+	switch {
+	case r.Step > 0 && r.Start < r.End:
+		span, step = uint64(r.End)-uint64(r.Start), uint64(r.Step)
+	case r.Step < 0 && r.Start > r.End:
+		span, step = uint64(r.Start)-uint64(r.End), uint64(-r.Step)
+	default:
+		return 0
+	}
+	return int64((span-1)/step + 1)
+}
+
+/*---------------------------------------------------------------------------*/
+
+// ErrorKind : エラーの種類
+type ErrorKind string
+
+const (
+	ERROR               ErrorKind = "Error" // 種類の無いエラー、エラー以外の値を throw した場合
+	TYPE_ERROR          ErrorKind = "TypeError"
+	NAME_ERROR          ErrorKind = "NameError"
+	INDEX_ERROR         ErrorKind = "IndexError"
+	ARGUMENT_ERROR      ErrorKind = "ArgumentError"
+	ZERO_DIVISION_ERROR ErrorKind = "ZeroDivisionError"
+	OVERFLOW_ERROR      ErrorKind = "OverflowError"
+	SYNTAX_ERROR        ErrorKind = "SyntaxError"    // parser で検出できなかった構文の誤り
+	RECURSION_ERROR     ErrorKind = "RecursionError" // 呼び出しが深すぎる
+	INTERNAL_ERROR      ErrorKind = "InternalError"  // 評価中の Go の panic
+)
+
+// Error : 評価を中断して伝播するエラー
+//
+// Go の error としても扱えるので、組み込む側では errors.As で取り出して Kind を調べられる
 type Error struct {
+	Kind    ErrorKind
 	Message string
+	Pos     token.Position // 位置が不明な場合は無効な Position
+	Stack   []Frame        // 呼び出し履歴 (内側の呼び出しが先頭)
+	Value   Object         // throw された値、実行時エラーの場合は nil
 }
 
 func (e *Error) Type() ObjectType { return ERROR_OBJ }
-func (e *Error) Inspect() string  { return "ERROR: " + e.Message }
+func (e *Error) Inspect() string {
+	var out bytes.Buffer
+
+	out.WriteString("ERROR: ")
+	out.WriteString(e.Error())
+
+	// 深い再帰の履歴は内側と外側の呼び出しだけを表示する
+	inner, outer := e.Stack, []Frame{}
+	if len(e.Stack) > maxInspectFrames {
+		inner = e.Stack[:maxInspectFrames/2]
+		outer = e.Stack[len(e.Stack)-maxInspectFrames/2:]
+	}
+	for _, frame := range inner {
+		out.WriteString("\n\tat " + frame.String())
+	}
+	if omitted := len(e.Stack) - len(inner) - len(outer); omitted > 0 {
+		out.WriteString(fmt.Sprintf("\n\t... %d more frames", omitted))
+	}
+	for _, frame := range outer {
+		out.WriteString("\n\tat " + frame.String())
+	}
+
+	return out.String()
+}
+
+// Error.Inspect が表示する呼び出し履歴の最大数
+const maxInspectFrames = 20
+
+// Error : implements the error interface, "<pos>: <kind>: <message>"
+func (e *Error) Error() string {
+	var out bytes.Buffer
+
+	if e.Pos.IsValid() {
+		out.WriteString(e.Pos.String() + ": ")
+	}
+	if e.Kind != "" {
+		out.WriteString(string(e.Kind) + ": ")
+	}
+	out.WriteString(e.Message)
+
+	return out.String()
+}
+
+/*---------------------------------------------------------------------------*/
+
+// ErrorValue : プログラムから扱えるエラーの値
+//
+// catch で捕まえた実行時エラーや error() で作ったエラーで、object.Error と違い伝播しない
+// e["message"], e["type"], e["stack"] で中身を取り出せる
+type ErrorValue struct {
+	Kind    ErrorKind
+	Message string
+	Stack   []Frame
+}
+
+func (ev *ErrorValue) Type() ObjectType { return ERROR_VALUE_OBJ }
+func (ev *ErrorValue) Inspect() string {
+	return string(ev.Kind) + ": " + ev.Message
+}
+
+// Field : e["message"] などで取り出す値、該当するものが無ければ false
+func (ev *ErrorValue) Field(name string) (Object, bool) {
+	switch name {
+	case "message":
+		return &String{Value: ev.Message}, true
+	case "type":
+		return &String{Value: string(ev.Kind)}, true
+	case "stack":
+		stack := []Object{}
+		for _, frame := range ev.Stack {
+			stack = append(stack, &String{Value: frame.String()})
+		}
+		return &Array{Elements: stack}, true
+	}
+	return nil, false
+}
+
+// Frame : a Monkey function call, used for stack traces
+type Frame struct {
+	Function string         // 呼び出された関数の名前 (式)
+	Pos      token.Position // 呼び出し位置
+}
+
+func (f Frame) String() string {
+	return f.Function + " (" + f.Pos.String() + ")"
+}
+
+// CallFrame : 実行中の関数呼び出し、Caller をたどると呼び出し履歴になる
+type CallFrame struct {
+	Frame
+	Caller *CallFrame // 呼び出し元、トップレベルからの呼び出しなら nil
+	Depth  int        // 呼び出しの深さ (トップレベルからの呼び出しが 1)
+}
+
+// Trace : この呼び出しから順に、呼び出し元をたどった履歴を返す
+func (f *CallFrame) Trace() []Frame {
+	trace := []Frame{}
+	for frame := f; frame != nil; frame = frame.Caller {
+		trace = append(trace, frame.Frame)
+	}
+	return trace
+}
 
 /*---------------------------------------------------------------------------*/
 
 type Function struct {
+	Name       string // 無名関数なら空
 	Parameters []*ast.Identifier
+	Defaults   []ast.Expression // デフォルト値、呼び出しのたびに関数の環境で評価する
+	Rest       *ast.Identifier  // 残余引数、余った引数を配列として束縛する
 	Body       *ast.BlockStatement
 	Env        *Environment
 }
@@ -101,14 +308,12 @@ func (f *Function) Type() ObjectType { return FUNCTION_OBJ }
 func (f *Function) Inspect() string {
 	var out bytes.Buffer
 
-	params := []string{}
-	for _, p := range f.Parameters {
-		params = append(params, p.String())
-	}
-
 	out.WriteString("fn")
+	if f.Name != "" {
+		out.WriteString(" " + f.Name)
+	}
 	out.WriteString("(")
-	out.WriteString(strings.Join(params, ", "))
+	out.WriteString(ast.ParametersString(f.Parameters, f.Defaults, f.Rest))
 	out.WriteString(") {\n")
 	out.WriteString(f.Body.String())
 	out.WriteString("\n}")
@@ -119,40 +324,118 @@ func (f *Function) Inspect() string {
 /*---------------------------------------------------------------------------*/
 
 type Class struct {
-	Name *ast.Identifier
-	Body *ast.BlockStatement
+	Name    *ast.Identifier
+	Parent  *Class       // 継承しなければ nil
+	Env     *Environment // クラスを定義した環境
+	Statics *Environment // static メンバ、クラスを定義したときに一度だけ評価する
+	Body    *ast.BlockStatement
 }
 
 func (c *Class) Type() ObjectType { return CLASS_OBJ }
 func (c *Class) Inspect() string {
 	var out bytes.Buffer
 
-	out.WriteString("class")
-	out.WriteString(c.Name.String())
-	out.WriteString("{")
+	out.WriteString("class ")
+	out.WriteString(c.Hierarchy())
+	out.WriteString(" {")
 	out.WriteString(c.Body.String())
 	out.WriteString("}")
 
 	return out.String()
 }
 
+// Member : static メンバを探す、見つからなければ親クラスをたどる
+//
+// 見つかったメンバを束縛している環境も返す
+func (c *Class) Member(name string) (Object, *Environment, bool) {
+	for class := c; class != nil; class = class.Parent {
+		if class.Statics == nil {
+			continue
+		}
+		if obj, ok := class.Statics.store[name]; ok {
+			return obj, class.Statics, true
+		}
+	}
+	return nil, nil, false
+}
+
+// Hierarchy : 継承関係を "Dog < Animal < Base" の形で表す
+func (c *Class) Hierarchy() string {
+	names := []string{}
+	for class := c; class != nil; class = class.Parent {
+		names = append(names, class.Name.String())
+	}
+	return strings.Join(names, " < ")
+}
+
 /*---------------------------------------------------------------------------*/
 
+// Instance : クラスから生成したオブジェクト
+//
+// 継承したクラスの本体はクラスごとに別の環境で評価する
+// Super は親クラスの本体を評価した部分で、This の outer にもなっている
 type Instance struct {
 	Class *Class
 	This  *Environment
+	Super *Instance
+
+	// InspectInstance を呼び出している途中か (__str__ の中で自分自身を Inspect しても止まるように)
+	inspecting bool
 }
 
+// InspectInstance : __str__ メソッドを持つインスタンスの文字列表現を求める
+//
+// object からはメソッドを呼び出せないので evaluator が設定する
+// 文字列表現が求められなければ false を返し、Inspect は既定の表現になる
+var InspectInstance func(i *Instance) (string, bool)
+
 func (i *Instance) Type() ObjectType { return INSTANCE_OBJ }
 func (i *Instance) Inspect() string {
+	if InspectInstance != nil && !i.inspecting {
+		i.inspecting = true
+		str, ok := InspectInstance(i)
+		i.inspecting = false
+		if ok {
+			return str
+		}
+	}
+
 	var out bytes.Buffer
 
-	out.WriteString("instanfe of ")
-	out.WriteString(i.Class.Name.String())
+	out.WriteString("instance of ")
+	out.WriteString(i.Class.Hierarchy())
 
 	return out.String()
 }
 
+// Member : メンバを探す、見つからなければ親クラスの部分をたどる
+//
+// 見つかったメンバを束縛している環境も返す
+func (i *Instance) Member(name string) (Object, *Environment, bool) {
+	for part := i; part != nil; part = part.Super {
+		if obj, ok := part.This.store[name]; ok {
+			return obj, part.This, true
+		}
+	}
+	return nil, nil, false
+}
+
+// MemberNames : 親クラスの部分も含めたメンバの名前 (名前順、重複なし)
+func (i *Instance) MemberNames() []string {
+	seen := map[string]bool{}
+	names := []string{}
+	for part := i; part != nil; part = part.Super {
+		for name := range part.This.store {
+			if !seen[name] {
+				seen[name] = true
+				names = append(names, name)
+			}
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
 /*---------------------------------------------------------------------------*/
 
 type This struct {
@@ -167,6 +450,42 @@ func (t *This) Inspect() string {
 
 /*---------------------------------------------------------------------------*/
 
+// Super : クラス Class のメソッドから見た親クラスの部分
+//
+// 親クラスがなければ Instance は nil
+// super.method で取り出したメソッドは This (インスタンス全体) に束縛する
+type Super struct {
+	Class    *Class
+	Instance *Instance
+	This     *Instance
+}
+
+func (s *Super) Type() ObjectType { return SUPER_OBJ }
+func (s *Super) Inspect() string {
+	return "super of " + s.Class.Name.String()
+}
+
+/*---------------------------------------------------------------------------*/
+
+// BoundMethod : obj.method で取り出したメソッド
+//
+// 呼び出すと、関数がどこで定義されたかに関わらず this が Receiver になる
+type BoundMethod struct {
+	Receiver *Instance
+	Function *Function
+}
+
+func (bm *BoundMethod) Type() ObjectType { return BOUND_METHOD_OBJ }
+func (bm *BoundMethod) Inspect() string {
+	name := bm.Function.Name
+	if name == "" {
+		name = "fn"
+	}
+	return "bound method " + name + " of " + bm.Receiver.Inspect()
+}
+
+/*---------------------------------------------------------------------------*/
+
 type Reference struct {
 	Env  *Environment
 	Name string
@@ -181,8 +500,18 @@ func (r *Reference) Inspect() string {
 	return "<missing reference>"
 }
 
+// Assign : 変数が定義されているスコープの束縛を書き換える
+//
+// 書き換えられない場合は *Error を返す
 func (r *Reference) Assign(obj Object) Object {
-	return r.Env.Set(r.Name, obj)
+	if err := r.Env.Assign(r.Name, obj); err != nil {
+		kind := NAME_ERROR
+		if err == ErrConstant {
+			kind = TYPE_ERROR
+		}
+		return &Error{Kind: kind, Message: err.Error() + ": " + r.Name}
+	}
+	return obj
 }
 
 func (r *Reference) Value() Object {
@@ -236,12 +565,20 @@ type Array struct {
 }
 
 func (ao *Array) Type() ObjectType { return ARRAY_OBJ }
-func (ao *Array) Inspect() string {
+func (ao *Array) Inspect() string  { return ao.inspect(map[Object]bool{}) }
+
+func (ao *Array) inspect(visiting map[Object]bool) string {
+	if visiting[ao] {
+		return "[...]"
+	}
+	visiting[ao] = true
+	defer delete(visiting, ao)
+
 	var out bytes.Buffer
 
 	elements := []string{}
 	for _, e := range ao.Elements {
-		elements = append(elements, e.Inspect())
+		elements = append(elements, inspectElement(e, visiting))
 	}
 
 	out.WriteString("[")
@@ -275,6 +612,15 @@ func (i *Integer) HashKey() HashKey {
 	return HashKey{Type: i.Type(), Value: uint64(i.Value)}
 }
 
+// 整数値と等しい Float は、同じ値の Integer と同じキーになる (1.0 と 1 は同じキー)
+// NaN はどの値とも等しくならないため、ハッシュのキーとしては使えない
+func (f *Float) HashKey() HashKey {
+	if f.Value == math.Trunc(f.Value) && f.Value >= math.MinInt64 && f.Value < math.MaxInt64 {
+		return HashKey{Type: INTEGER_OBJ, Value: uint64(int64(f.Value))}
+	}
+	return HashKey{Type: f.Type(), Value: math.Float64bits(f.Value)}
+}
+
 func (s *String) HashKey() HashKey {
 	h := fnv.New64a()
 	h.Write([]byte(s.Value))
@@ -296,13 +642,21 @@ type Hash struct {
 
 func (h *Hash) Type() ObjectType { return HASH_OBJ }
 
-func (h *Hash) Inspect() string {
+func (h *Hash) Inspect() string { return h.inspect(map[Object]bool{}) }
+
+func (h *Hash) inspect(visiting map[Object]bool) string {
+	if visiting[h] {
+		return "{...}"
+	}
+	visiting[h] = true
+	defer delete(visiting, h)
+
 	var out bytes.Buffer
 
 	pairs := []string{}
 	for _, pair := range h.Pairs {
 		pairs = append(pairs, fmt.Sprintf("%s: %s",
-			pair.Key.Inspect(), pair.Value.Inspect()))
+			inspectElement(pair.Key, visiting), inspectElement(pair.Value, visiting)))
 	}
 
 	out.WriteString("{")
@@ -312,6 +666,20 @@ func (h *Hash) Inspect() string {
 	return out.String()
 }
 
+// inspectElement : 配列やハッシュの要素の文字列表現
+//
+// visiting は表示している途中の配列とハッシュ。自分自身を含んでいる場合は
+// その位置を [...] または {...} と表示する
+func inspectElement(obj Object, visiting map[Object]bool) string {
+	switch obj := obj.(type) {
+	case *Array:
+		return obj.inspect(visiting)
+	case *Hash:
+		return obj.inspect(visiting)
+	}
+	return obj.Inspect()
+}
+
 type Hashable interface {
 	HashKey() HashKey
 }
@@ -1,6 +1,11 @@
 package object
 
-import "testing"
+import (
+	"fmt"
+	"math"
+	"strings"
+	"testing"
+)
 
 func TestStringHashKey(t *testing.T) {
 	hello1 := &String{Value: "Hello World"}
@@ -57,3 +62,69 @@ func TestBooleanHashKey(t *testing.T) {
 		t.Errorf("boolean with different content have same hash keys")
 	}
 }
+
+func TestErrorInspect(t *testing.T) {
+	err := &Error{Message: "boom"}
+	if err.Inspect() != "ERROR: boom" {
+		t.Errorf("wrong Inspect. got=%q", err.Inspect())
+	}
+
+	for i := 0; i < 25; i++ {
+		err.Stack = append(err.Stack, Frame{Function: fmt.Sprintf("f%d", i)})
+	}
+	lines := strings.Split(err.Inspect(), "\n")
+	// メッセージ、内側の 10 件、省略、外側の 10 件
+	if len(lines) != 22 {
+		t.Fatalf("wrong number of lines. expected=22, got=%d\n%s", len(lines), err.Inspect())
+	}
+	if lines[11] != "\t... 5 more frames" {
+		t.Errorf("wrong omission line. got=%q", lines[11])
+	}
+	if !strings.HasPrefix(lines[12], "\tat f15 ") {
+		t.Errorf("wrong frame after omission. got=%q", lines[12])
+	}
+}
+
+func TestCyclicInspect(t *testing.T) {
+	array := &Array{Elements: []Object{&Integer{Value: 1}}}
+	array.Elements = append(array.Elements, array)
+	if array.Inspect() != "[1, [...]]" {
+		t.Errorf("wrong Inspect of cyclic array. got=%q", array.Inspect())
+	}
+
+	key := &String{Value: "self"}
+	hash := &Hash{Pairs: map[HashKey]HashPair{}}
+	hash.Pairs[key.HashKey()] = HashPair{Key: key, Value: &Array{Elements: []Object{hash}}}
+	if hash.Inspect() != "{self: [{...}]}" {
+		t.Errorf("wrong Inspect of cyclic hash. got=%q", hash.Inspect())
+	}
+
+	// 同じ配列が何度現れても、循環していなければそのまま表示する
+	shared := &Array{Elements: []Object{&Integer{Value: 2}}}
+	pair := &Array{Elements: []Object{shared, shared}}
+	if pair.Inspect() != "[[2], [2]]" {
+		t.Errorf("wrong Inspect of shared array. got=%q", pair.Inspect())
+	}
+}
+
+func TestFloatHashKey(t *testing.T) {
+	float1 := &Float{Value: 1.5}
+	float2 := &Float{Value: 1.5}
+	diff := &Float{Value: 2.5}
+
+	if float1.HashKey() != float2.HashKey() {
+		t.Errorf("float with same content have different hash keys")
+	}
+
+	if float1.HashKey() == diff.HashKey() {
+		t.Errorf("float with different content have same hash keys")
+	}
+
+	if (&Float{Value: 3.0}).HashKey() != (&Integer{Value: 3}).HashKey() {
+		t.Errorf("integral float and integer have different hash keys")
+	}
+
+	if (&Float{Value: 0.0}).HashKey() != (&Float{Value: math.Copysign(0, -1)}).HashKey() {
+		t.Errorf("0.0 and -0.0 have different hash keys")
+	}
+}
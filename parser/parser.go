@@ -13,29 +13,51 @@ const (
 	_ int = iota
 	LOWEST
 	ASSIGN      // =
+	LOGICALOR   // ||
+	LOGICALAND  // &&
 	EQUALS      // ==
-	LESSGREATER // >, <
+	LESSGREATER // >, <, >=, <=
+	BITOR       // |
+	BITXOR      // ^
+	BITAND      // &
+	SHIFT       // <<, >>
 	SUM         // +, -
-	PRODUCT     // *, /
-	PREFIX      // -x, !x
+	PRODUCT     // *, /, %
+	PREFIX      // -x, !x, ~x
+	POWER       // x ** y (右結合)
 	CALL        // myFunction(x)
 	INDEX       // array[index]
 	DOT         // foo.name
 )
 
 var precedences = map[token.TokenType]int{
-	token.ASSIGN:   ASSIGN,
-	token.EQ:       EQUALS,
-	token.NOTEQ:    EQUALS,
-	token.LT:       LESSGREATER,
-	token.GT:       LESSGREATER,
-	token.PLUS:     SUM,
-	token.MINUS:    SUM,
-	token.SLASH:    PRODUCT,
-	token.ASTERISK: PRODUCT,
-	token.LPAREN:   CALL,
-	token.LBRACKET: INDEX,
-	token.DOT:      DOT,
+	token.ASSIGN:          ASSIGN,
+	token.PLUS_ASSIGN:     ASSIGN,
+	token.MINUS_ASSIGN:    ASSIGN,
+	token.ASTERISK_ASSIGN: ASSIGN,
+	token.SLASH_ASSIGN:    ASSIGN,
+	token.EQ:              EQUALS,
+	token.NOTEQ:           EQUALS,
+	token.LT:              LESSGREATER,
+	token.GT:              LESSGREATER,
+	token.LTEQ:            LESSGREATER,
+	token.GTEQ:            LESSGREATER,
+	token.AND:             LOGICALAND,
+	token.OR:              LOGICALOR,
+	token.PLUS:            SUM,
+	token.MINUS:           SUM,
+	token.SLASH:           PRODUCT,
+	token.ASTERISK:        PRODUCT,
+	token.PERCENT:         PRODUCT,
+	token.POWER:           POWER,
+	token.PIPE:            BITOR,
+	token.CARET:           BITXOR,
+	token.AMPERSAND:       BITAND,
+	token.SHL:             SHIFT,
+	token.SHR:             SHIFT,
+	token.LPAREN:          CALL,
+	token.LBRACKET:        INDEX,
+	token.DOT:             DOT,
 }
 
 type Parser struct {
@@ -45,6 +67,12 @@ type Parser struct {
 	curToken  token.Token
 	peekToken token.Token
 
+	// lexer.ScanComments モードのときに読み飛ばしたコメント
+	comments []*ast.Comment
+	pending  []*ast.Comment // まだどの文にも付与されていないコメント
+
+	loopDepth int // break / continue が書けるかどうかの判定に使う、関数の中に入るとリセットされる
+
 	prefixParseFns map[token.TokenType]prefixParseFn
 	infixParseFns  map[token.TokenType]infixParseFn
 }
@@ -67,32 +95,52 @@ func New(l *lexer.Lexer) *Parser {
 	p.registerPrefix(token.IDENT, p.parseIdentifier)
 	p.registerPrefix(token.THIS, p.parseThis)
 	p.registerPrefix(token.INT, p.parseIntegerLiteral)
+	p.registerPrefix(token.FLOAT, p.parseFloatLiteral)
 	p.registerPrefix(token.BANG, p.parsePrefixExpression)
 	p.registerPrefix(token.MINUS, p.parsePrefixExpression)
+	p.registerPrefix(token.TILDE, p.parsePrefixExpression)
 	p.registerPrefix(token.TRUE, p.parseBoolean)
 	p.registerPrefix(token.FALSE, p.parseBoolean)
 	p.registerPrefix(token.LPAREN, p.parseGroupedExpression)
 	p.registerPrefix(token.IF, p.parseIfExpression)
 	p.registerPrefix(token.FUNCTION, p.parseFunctionLiteral)
 	p.registerPrefix(token.CLASS, p.parseClassLiteral)
+	p.registerPrefix(token.SUPER, p.parseSuper)
 	p.registerPrefix(token.STRING, p.parseStringLiteral)
+	p.registerPrefix(token.TEMPLATE_HEAD, p.parseTemplateLiteral)
 	p.registerPrefix(token.LBRACKET, p.parseArrayLiteral)
 	p.registerPrefix(token.LBRACE, p.parseHashLiteral)
 	p.registerPrefix(token.MACRO, p.parseMacroLiteral)
+	p.registerPrefix(token.ILLEGAL, p.parseIllegal)
 
 	p.infixParseFns = make(map[token.TokenType]infixParseFn)
 	p.registerInfix(token.PLUS, p.parseInfixExpression)
 	p.registerInfix(token.MINUS, p.parseInfixExpression)
 	p.registerInfix(token.SLASH, p.parseInfixExpression)
 	p.registerInfix(token.ASTERISK, p.parseInfixExpression)
+	p.registerInfix(token.PERCENT, p.parseInfixExpression)
+	p.registerInfix(token.POWER, p.parseInfixExpression)
+	p.registerInfix(token.AMPERSAND, p.parseInfixExpression)
+	p.registerInfix(token.PIPE, p.parseInfixExpression)
+	p.registerInfix(token.CARET, p.parseInfixExpression)
+	p.registerInfix(token.SHL, p.parseInfixExpression)
+	p.registerInfix(token.SHR, p.parseInfixExpression)
 	p.registerInfix(token.EQ, p.parseInfixExpression)
 	p.registerInfix(token.NOTEQ, p.parseInfixExpression)
 	p.registerInfix(token.LT, p.parseInfixExpression)
 	p.registerInfix(token.GT, p.parseInfixExpression)
+	p.registerInfix(token.LTEQ, p.parseInfixExpression)
+	p.registerInfix(token.GTEQ, p.parseInfixExpression)
+	p.registerInfix(token.AND, p.parseInfixExpression)
+	p.registerInfix(token.OR, p.parseInfixExpression)
 	p.registerInfix(token.LPAREN, p.parseCallExpression)
 	p.registerInfix(token.LBRACKET, p.parseIndexExpression)
 	p.registerInfix(token.DOT, p.parseDotExpression)
 	p.registerInfix(token.ASSIGN, p.parseAssignmentExpression)
+	p.registerInfix(token.PLUS_ASSIGN, p.parseAssignmentExpression)
+	p.registerInfix(token.MINUS_ASSIGN, p.parseAssignmentExpression)
+	p.registerInfix(token.ASTERISK_ASSIGN, p.parseAssignmentExpression)
+	p.registerInfix(token.SLASH_ASSIGN, p.parseAssignmentExpression)
 
 	// 二つのトークンを読み込むことで、curToken および peekToken の両方がセットされる
 	p.nextToken()
@@ -106,10 +154,15 @@ func (p *Parser) Errors() []string {
 	return p.errors
 }
 
+// errorf : record a parse error prefixed with the source position
+func (p *Parser) errorf(pos token.Position, format string, a ...interface{}) {
+	msg := pos.String() + ": " + fmt.Sprintf(format, a...)
+	p.errors = append(p.errors, msg)
+}
+
 func (p *Parser) peekError(t token.TokenType) {
-	msg := fmt.Sprintf("expected next token to be %s, got %s insted",
+	p.errorf(p.peekToken.Pos, "expected next token to be %s, got %s insted",
 		t, p.peekToken.Type)
-	p.errors = append(p.errors, msg)
 }
 
 func (p *Parser) peekPrecedence() int {
@@ -129,6 +182,45 @@ func (p *Parser) curPrecendence() int {
 func (p *Parser) nextToken() {
 	p.curToken = p.peekToken
 	p.peekToken = p.l.NextToken()
+
+	// コメントは構文解析の対象にせず、後で文に付与するために取っておく
+	for p.peekToken.Type == token.COMMENT {
+		comment := &ast.Comment{Token: p.peekToken}
+		p.comments = append(p.comments, comment)
+		p.pending = append(p.pending, comment)
+		p.peekToken = p.l.NextToken()
+	}
+}
+
+// takeComments : remove and return pending comments which end before pos
+func (p *Parser) takeComments(pos token.Position) []*ast.Comment {
+	var taken []*ast.Comment
+	i := 0
+	for ; i < len(p.pending); i++ {
+		if p.pending[i].End().Offset > pos.Offset {
+			break
+		}
+		taken = append(taken, p.pending[i])
+	}
+	p.pending = p.pending[i:]
+	return taken
+}
+
+// withTrailingComments : append pending comments which start on or before the line
+// where the current statement ends
+//
+// 文の後ろの同じ行にあるコメントは、次の文ではなくその文に付与する
+func (p *Parser) withTrailingComments(comments []*ast.Comment) []*ast.Comment {
+	line := p.curToken.End.Line
+	i := 0
+	for ; i < len(p.pending); i++ {
+		if p.pending[i].Pos().Line > line {
+			break
+		}
+		comments = append(comments, p.pending[i])
+	}
+	p.pending = p.pending[i:]
+	return comments
 }
 
 func (p *Parser) ParseProgram() *ast.Program {
@@ -145,24 +237,84 @@ func (p *Parser) ParseProgram() *ast.Program {
 		}
 		p.nextToken()
 	}
+	program.Comments = p.comments
 
 	return program
 }
 
 func (p *Parser) parseStatement() ast.Statement {
+	comments := p.takeComments(p.curToken.Pos)
+
 	switch p.curToken.Type {
-	case token.LET:
-		return p.parseLetStatement()
+	case token.LET, token.CONST:
+		stmt := p.parseLetStatement()
+		if stmt == nil {
+			return nil
+		}
+		stmt.Comments = p.withTrailingComments(comments)
+		return stmt
+	case token.FUNCTION:
+		if !p.peekTokenIs(token.IDENT) {
+			stmt := p.parseExpressionStatement()
+			stmt.Comments = p.withTrailingComments(comments)
+			return stmt
+		}
+		stmt := p.parseFunctionStatement()
+		if stmt == nil {
+			return nil
+		}
+		stmt.Comments = p.withTrailingComments(comments)
+		return stmt
 	case token.RETURN:
-		return p.parseReturnStatement()
+		stmt := p.parseReturnStatement()
+		stmt.Comments = p.withTrailingComments(comments)
+		return stmt
+	case token.WHILE:
+		stmt := p.parseWhileStatement()
+		if stmt == nil {
+			return nil
+		}
+		stmt.Comments = p.withTrailingComments(comments)
+		return stmt
+	case token.FOR:
+		stmt := p.parseForStatement()
+		if stmt == nil {
+			return nil
+		}
+		stmt.Comments = p.withTrailingComments(comments)
+		return stmt
+	case token.BREAK:
+		stmt := p.parseBreakStatement()
+		stmt.Comments = p.withTrailingComments(comments)
+		return stmt
+	case token.CONTINUE:
+		stmt := p.parseContinueStatement()
+		stmt.Comments = p.withTrailingComments(comments)
+		return stmt
+	case token.TRY:
+		stmt := p.parseTryStatement()
+		if stmt == nil {
+			return nil
+		}
+		stmt.Comments = p.withTrailingComments(comments)
+		return stmt
+	case token.THROW:
+		stmt := p.parseThrowStatement()
+		stmt.Comments = p.withTrailingComments(comments)
+		return stmt
+	case token.STATIC:
+		p.errorf(p.curToken.Pos, "static declaration outside of class body")
+		return nil
 	default:
-		return p.parseExpressionStatement()
+		stmt := p.parseExpressionStatement()
+		stmt.Comments = p.withTrailingComments(comments)
+		return stmt
 	}
 }
 
 func (p *Parser) parseIdentifier() ast.Expression {
 
-	ref := p.peekToken.Type == token.ASSIGN
+	ref := isAssignmentToken(p.peekToken.Type)
 
 	return &ast.Identifier{
 		Token:     p.curToken,
@@ -175,6 +327,10 @@ func (p *Parser) parseThis() ast.Expression {
 	return p.parseIdentifier()
 }
 
+func (p *Parser) parseSuper() ast.Expression {
+	return &ast.Super{Token: p.curToken}
+}
+
 func (p *Parser) parseLetStatement() *ast.LetStatement {
 	stmt := &ast.LetStatement{
 		Token: p.curToken,
@@ -198,6 +354,12 @@ func (p *Parser) parseLetStatement() *ast.LetStatement {
 
 	stmt.Value = p.parseExpression(LOWEST)
 
+	// let f = fn() {} の無名関数には束縛先の名前を付ける
+	if lit, ok := stmt.Value.(*ast.FunctionLiteral); ok && lit.Name == "" {
+		lit.Name = stmt.Name.Value
+		lit.Inferred = true
+	}
+
 	if p.peekTokenIs(token.SEMICOLON) {
 		p.nextToken()
 	}
@@ -205,6 +367,19 @@ func (p *Parser) parseLetStatement() *ast.LetStatement {
 	return stmt
 }
 
+func (p *Parser) parseFunctionStatement() *ast.FunctionStatement {
+	lit, ok := p.parseFunctionLiteral().(*ast.FunctionLiteral)
+	if !ok {
+		return nil
+	}
+
+	if p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
+
+	return &ast.FunctionStatement{Function: lit}
+}
+
 func (p *Parser) parseReturnStatement() *ast.ReturnStatement {
 	stmt := &ast.ReturnStatement{Token: p.curToken}
 
@@ -212,13 +387,180 @@ func (p *Parser) parseReturnStatement() *ast.ReturnStatement {
 
 	stmt.ReturnValue = p.parseExpression(LOWEST)
 
-	for !p.curTokenIs(token.SEMICOLON) {
+	if p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
+
+	return stmt
+}
+
+func (p *Parser) parseWhileStatement() *ast.WhileStatement {
+	stmt := &ast.WhileStatement{Token: p.curToken}
+
+	if !p.expectPeek(token.LPAREN) {
+		return nil
+	}
+
+	p.nextToken()
+	stmt.Condition = p.parseExpression(LOWEST)
+
+	if !p.expectPeek(token.RPAREN) {
+		return nil
+	}
+
+	if !p.expectPeek(token.LBRACE) {
+		return nil
+	}
+
+	stmt.Body = p.parseLoopBody()
+
+	if p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
+
+	return stmt
+}
+
+// try { } catch (e) { } finally { }
+func (p *Parser) parseTryStatement() *ast.TryStatement {
+	stmt := &ast.TryStatement{Token: p.curToken}
+
+	if !p.expectPeek(token.LBRACE) {
+		return nil
+	}
+	stmt.Body = p.parseBlockStatement()
+
+	if p.peekTokenIs(token.CATCH) {
+		p.nextToken()
+
+		if !p.expectPeek(token.LPAREN) {
+			return nil
+		}
+		if !p.expectPeek(token.IDENT) {
+			return nil
+		}
+		stmt.Param = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+		if !p.expectPeek(token.RPAREN) {
+			return nil
+		}
+
+		if !p.expectPeek(token.LBRACE) {
+			return nil
+		}
+		stmt.Catch = p.parseBlockStatement()
+	}
+
+	if p.peekTokenIs(token.FINALLY) {
+		p.nextToken()
+
+		if !p.expectPeek(token.LBRACE) {
+			return nil
+		}
+		stmt.Finally = p.parseBlockStatement()
+	}
+
+	if stmt.Catch == nil && stmt.Finally == nil {
+		p.errorf(stmt.Token.Pos, "try without catch or finally")
+		return nil
+	}
+
+	if p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
+
+	return stmt
+}
+
+func (p *Parser) parseThrowStatement() *ast.ThrowStatement {
+	stmt := &ast.ThrowStatement{Token: p.curToken}
+
+	p.nextToken()
+
+	stmt.Value = p.parseExpression(LOWEST)
+
+	if p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
+
+	return stmt
+}
+
+// for (x in coll) { } または for (k, v in coll) { }
+func (p *Parser) parseForStatement() *ast.ForStatement {
+	stmt := &ast.ForStatement{Token: p.curToken}
+
+	if !p.expectPeek(token.LPAREN) {
+		return nil
+	}
+
+	if !p.expectPeek(token.IDENT) {
+		return nil
+	}
+	stmt.Value = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+
+	if p.peekTokenIs(token.COMMA) {
+		p.nextToken()
+		if !p.expectPeek(token.IDENT) {
+			return nil
+		}
+		stmt.Key = stmt.Value
+		stmt.Value = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+	}
+
+	if !p.expectPeek(token.IN) {
+		return nil
+	}
+
+	p.nextToken()
+	stmt.Iterable = p.parseExpression(LOWEST)
+
+	if !p.expectPeek(token.RPAREN) {
+		return nil
+	}
+
+	if !p.expectPeek(token.LBRACE) {
+		return nil
+	}
+
+	stmt.Body = p.parseLoopBody()
+
+	if p.peekTokenIs(token.SEMICOLON) {
 		p.nextToken()
 	}
 
 	return stmt
 }
 
+func (p *Parser) parseLoopBody() *ast.BlockStatement {
+	p.loopDepth++
+	defer func() { p.loopDepth-- }()
+
+	return p.parseBlockStatement()
+}
+
+func (p *Parser) parseBreakStatement() *ast.BreakStatement {
+	stmt := &ast.BreakStatement{Token: p.curToken}
+	p.parseLoopControl()
+	return stmt
+}
+
+func (p *Parser) parseContinueStatement() *ast.ContinueStatement {
+	stmt := &ast.ContinueStatement{Token: p.curToken}
+	p.parseLoopControl()
+	return stmt
+}
+
+// parseLoopControl : break と continue に共通の処理
+func (p *Parser) parseLoopControl() {
+	if p.loopDepth == 0 {
+		p.errorf(p.curToken.Pos, "%s is not in a loop", p.curToken.Literal)
+	}
+
+	if p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
+}
+
 func (p *Parser) parseExpressionStatement() *ast.ExpressionStatement {
 	defer untrace(trace("parseExpressionStatement"))
 
@@ -236,8 +578,13 @@ func (p *Parser) parseExpressionStatement() *ast.ExpressionStatement {
 
 // prefix expression parser function not found.
 func (p *Parser) noPrefixParseFnError(t token.TokenType) {
-	msg := fmt.Sprintf("no prefix parse function for %s found", t)
-	p.errors = append(p.errors, msg)
+	p.errorf(p.curToken.Pos, "no prefix parse function for %s found", t)
+}
+
+// ILLEGAL トークンの Literal は不正な文字、または字句解析エラーの内容
+func (p *Parser) parseIllegal() ast.Expression {
+	p.errorf(p.curToken.Pos, "illegal token: %s", p.curToken.Literal)
+	return nil
 }
 
 func (p *Parser) parseIntegerLiteral() ast.Expression {
@@ -247,8 +594,26 @@ func (p *Parser) parseIntegerLiteral() ast.Expression {
 
 	value, err := strconv.ParseInt(p.curToken.Literal, 0, 64)
 	if err != nil {
-		msg := fmt.Sprintf("could not parse %q as integer", p.curToken.Literal)
-		p.errors = append(p.errors, msg)
+		if numErr, ok := err.(*strconv.NumError); ok && numErr.Err == strconv.ErrRange {
+			p.errorf(p.curToken.Pos, "integer literal %s overflows int64", p.curToken.Literal)
+		} else {
+			p.errorf(p.curToken.Pos, "could not parse %q as integer", p.curToken.Literal)
+		}
+		return nil
+	}
+	lit.Value = value
+
+	return lit
+}
+
+func (p *Parser) parseFloatLiteral() ast.Expression {
+	defer untrace(trace("parseFloatLiteral"))
+
+	lit := &ast.FloatLiteral{Token: p.curToken}
+
+	value, err := strconv.ParseFloat(p.curToken.Literal, 64)
+	if err != nil {
+		p.errorf(p.curToken.Pos, "could not parse %q as float", p.curToken.Literal)
 		return nil
 	}
 	lit.Value = value
@@ -265,10 +630,44 @@ func (p *Parser) parseStringLiteral() ast.Expression {
 	return &ast.StringLiteral{Token: p.curToken, Value: p.curToken.Literal}
 }
 
+// "a${x}b${y}c" は TEMPLATE_HEAD x TEMPLATE_MIDDLE y TEMPLATE_TAIL として字句解析される
+func (p *Parser) parseTemplateLiteral() ast.Expression {
+	template := &ast.TemplateLiteral{Token: p.curToken, Texts: []string{p.curToken.Literal}}
+
+	for {
+		if p.peekTokenIs(token.TEMPLATE_MIDDLE) || p.peekTokenIs(token.TEMPLATE_TAIL) {
+			p.errorf(p.peekToken.Pos, "empty expression in string interpolation")
+			return nil
+		}
+		p.nextToken()
+		value := p.parseExpression(LOWEST)
+		if value == nil {
+			return nil
+		}
+		template.Values = append(template.Values, value)
+
+		p.nextToken()
+		switch p.curToken.Type {
+		case token.TEMPLATE_MIDDLE:
+			template.Texts = append(template.Texts, p.curToken.Literal)
+		case token.TEMPLATE_TAIL:
+			template.Texts = append(template.Texts, p.curToken.Literal)
+			template.Tail = p.curToken
+			return template
+		case token.ILLEGAL:
+			return p.parseIllegal()
+		default:
+			p.errorf(p.curToken.Pos, "expected } to close string interpolation, got %s", p.curToken.Type)
+			return nil
+		}
+	}
+}
+
 func (p *Parser) parseArrayLiteral() ast.Expression {
 	array := &ast.ArrayLiteral{Token: p.curToken}
 
 	array.Elements = p.parseExpressionList(token.RBRACKET)
+	array.Rbracket = p.curToken.Pos
 
 	return array
 }
@@ -282,12 +681,12 @@ func (p *Parser) parseExpressionList(end token.TokenType) []ast.Expression {
 	}
 
 	p.nextToken()
-	list = append(list, p.parseExpression(LOWEST))
+	list = append(list, p.parseListElement())
 
 	for p.peekTokenIs(token.COMMA) {
 		p.nextToken()
 		p.nextToken()
-		list = append(list, p.parseExpression(LOWEST))
+		list = append(list, p.parseListElement())
 	}
 
 	if !p.expectPeek(end) {
@@ -297,6 +696,18 @@ func (p *Parser) parseExpressionList(end token.TokenType) []ast.Expression {
 	return list
 }
 
+// 呼び出し引数や配列リテラルの要素では ...arr で配列を展開できる
+func (p *Parser) parseListElement() ast.Expression {
+	if !p.curTokenIs(token.ELLIPSIS) {
+		return p.parseExpression(LOWEST)
+	}
+
+	spread := &ast.SpreadExpression{Token: p.curToken}
+	p.nextToken()
+	spread.Value = p.parseExpression(LOWEST)
+	return spread
+}
+
 func (p *Parser) parseExpression(precedence int) ast.Expression {
 	defer untrace(trace("parseExpression"))
 
@@ -370,6 +781,7 @@ func (p *Parser) parseBlockStatement() *ast.BlockStatement {
 		}
 		p.nextToken()
 	}
+	block.Rbrace = p.curToken.Pos
 
 	return block
 }
@@ -402,6 +814,10 @@ func (p *Parser) parseInfixExpression(left ast.Expression) ast.Expression {
 	}
 
 	precedence := p.curPrecendence()
+	// 右結合の演算子は、右辺に同じ優先順位の演算子が続くことを許す
+	if p.curTokenIs(token.POWER) {
+		precedence--
+	}
 	p.nextToken()
 
 	expression.Right = p.parseExpression(precedence)
@@ -432,18 +848,29 @@ func (p *Parser) parseAssignmentExpression(left ast.Expression) ast.Expression {
 	defer untrace(trace("parseAssignmentExpression"))
 
 	expression := &ast.AssignmentExpression{
-		Token: p.curToken,
-		Left:  left,
+		Token:    p.curToken,
+		Left:     left,
+		Operator: p.curToken.Literal,
 	}
 
+	// 代入は右結合 (a = b = 1 は a = (b = 1))
 	precedence := p.curPrecendence()
 	p.nextToken()
 
-	expression.Right = p.parseExpression(precedence)
+	expression.Right = p.parseExpression(precedence - 1)
 
 	return expression
 }
 
+func isAssignmentToken(t token.TokenType) bool {
+	switch t {
+	case token.ASSIGN, token.PLUS_ASSIGN, token.MINUS_ASSIGN,
+		token.ASTERISK_ASSIGN, token.SLASH_ASSIGN:
+		return true
+	}
+	return false
+}
+
 func (p *Parser) parseGroupedExpression() ast.Expression {
 	p.nextToken()
 
@@ -457,21 +884,37 @@ func (p *Parser) parseGroupedExpression() ast.Expression {
 func (p *Parser) parseFunctionLiteral() ast.Expression {
 	lit := &ast.FunctionLiteral{Token: p.curToken}
 
+	// 名前は省略できる
+	if p.peekTokenIs(token.IDENT) {
+		p.nextToken()
+		lit.Name = p.curToken.Literal
+	}
+
 	if !p.expectPeek(token.LPAREN) {
 		return nil
 	}
 
-	lit.Parameters = p.parseFunctionParameters()
+	lit.Parameters, lit.Defaults, lit.Rest = p.parseParameterList()
 
 	if !p.expectPeek(token.LBRACE) {
 		return nil
 	}
 
-	lit.Body = p.parseBlockStatement()
+	lit.Body = p.parseFunctionBody()
+	ast.MarkTailCalls(lit.Body)
 
 	return lit
 }
 
+// 関数の本体からは外側のループを break / continue できない
+func (p *Parser) parseFunctionBody() *ast.BlockStatement {
+	loopDepth := p.loopDepth
+	p.loopDepth = 0
+	defer func() { p.loopDepth = loopDepth }()
+
+	return p.parseBlockStatement()
+}
+
 func (p *Parser) parseClassLiteral() ast.Expression {
 	lit := &ast.ClassLiteral{Token: p.curToken}
 
@@ -484,15 +927,69 @@ func (p *Parser) parseClassLiteral() ast.Expression {
 		Value: p.curToken.Literal,
 	}
 
+	if p.peekTokenIs(token.EXTENDS) {
+		p.nextToken()
+		p.nextToken()
+		lit.Parent = p.parseExpression(LOWEST)
+	}
+
 	if !p.expectPeek(token.LBRACE) {
 		return nil
 	}
 
-	lit.Body = p.parseBlockStatement()
+	lit.Body = p.parseClassBody()
 
 	return lit
 }
 
+// クラスの本体は関数の本体と同じだが、直下には static 宣言も書ける
+func (p *Parser) parseClassBody() *ast.BlockStatement {
+	loopDepth := p.loopDepth
+	p.loopDepth = 0
+	defer func() { p.loopDepth = loopDepth }()
+
+	block := &ast.BlockStatement{Token: p.curToken}
+	block.Statements = []ast.Statement{}
+
+	p.nextToken()
+
+	for !p.curTokenIs(token.RBRACE) && !p.curTokenIs(token.EOF) {
+		if p.curTokenIs(token.STATIC) {
+			comments := p.takeComments(p.curToken.Pos)
+			if stmt := p.parseStaticStatement(); stmt != nil {
+				stmt.Comments = comments
+				block.Statements = append(block.Statements, stmt)
+			}
+		} else if stmt := p.parseStatement(); stmt != nil {
+			block.Statements = append(block.Statements, stmt)
+		}
+		p.nextToken()
+	}
+	block.Rbrace = p.curToken.Pos
+
+	return block
+}
+
+func (p *Parser) parseStaticStatement() *ast.StaticStatement {
+	stmt := &ast.StaticStatement{Token: p.curToken}
+	p.nextToken()
+
+	switch {
+	case p.curTokenIs(token.LET), p.curTokenIs(token.CONST),
+		p.curTokenIs(token.FUNCTION) && p.peekTokenIs(token.IDENT):
+	default:
+		p.errorf(p.curToken.Pos, "expected let, const or fn declaration after static, got %s",
+			p.curToken.Type)
+		return nil
+	}
+
+	stmt.Statement = p.parseStatement()
+	if stmt.Statement == nil {
+		return nil
+	}
+	return stmt
+}
+
 func (p *Parser) parseMacroLiteral() ast.Expression {
 	lit := &ast.MacroLiteral{Token: p.curToken}
 
@@ -506,42 +1003,94 @@ func (p *Parser) parseMacroLiteral() ast.Expression {
 		return nil
 	}
 
-	lit.Body = p.parseBlockStatement()
+	lit.Body = p.parseFunctionBody()
 
 	return lit
 }
 
-// 関数の引数パーサ
+// マクロの引数パーサ、デフォルト値や残余引数は使えない
 func (p *Parser) parseFunctionParameters() []*ast.Identifier {
-	identifiers := []*ast.Identifier{}
+	pos := p.peekToken.Pos
+	identifiers, defaults, rest := p.parseParameterList()
+	if defaults != nil || rest != nil {
+		p.errorf(pos, "macro parameters cannot have default values or rest parameters")
+	}
+	return identifiers
+}
+
+// 関数の引数パーサ
+//
+//	fn(a, b = 2, ...rest)
+//
+// defaults は identifiers と同じ長さで、デフォルト値が一つも無ければ nil
+func (p *Parser) parseParameterList() (
+	identifiers []*ast.Identifier,
+	defaults []ast.Expression,
+	rest *ast.Identifier,
+) {
+	identifiers = []*ast.Identifier{}
 
 	if p.peekTokenIs(token.RPAREN) {
 		p.nextToken()
-		return identifiers
+		return identifiers, nil, nil
 	}
 
-	p.nextToken()
+	for {
+		p.nextToken()
 
-	ident := &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
-	identifiers = append(identifiers, ident)
+		if rest != nil {
+			p.errorf(p.curToken.Pos, "rest parameter must be last: ...%s", rest.Value)
+			return nil, nil, nil
+		}
 
-	for p.peekTokenIs(token.COMMA) {
-		p.nextToken()
+		if p.curTokenIs(token.ELLIPSIS) {
+			if !p.expectPeek(token.IDENT) {
+				return nil, nil, nil
+			}
+			rest = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+		} else {
+			if !p.curTokenIs(token.IDENT) {
+				p.errorf(p.curToken.Pos, "expected parameter name, got %s", p.curToken.Type)
+				return nil, nil, nil
+			}
+			ident := &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+
+			var value ast.Expression
+			if p.peekTokenIs(token.ASSIGN) {
+				p.nextToken()
+				p.nextToken()
+				value = p.parseExpression(LOWEST)
+				if defaults == nil {
+					defaults = make([]ast.Expression, len(identifiers))
+				}
+			} else if defaults != nil {
+				p.errorf(ident.Pos(), "parameter without default value follows default parameter: %s", ident.Value)
+				return nil, nil, nil
+			}
+
+			identifiers = append(identifiers, ident)
+			if defaults != nil {
+				defaults = append(defaults, value)
+			}
+		}
+
+		if !p.peekTokenIs(token.COMMA) {
+			break
+		}
 		p.nextToken()
-		ident := &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
-		identifiers = append(identifiers, ident)
 	}
 
 	if !p.expectPeek(token.RPAREN) {
-		return nil
+		return nil, nil, nil
 	}
 
-	return identifiers
+	return identifiers, defaults, rest
 }
 
 func (p *Parser) parseCallExpression(function ast.Expression) ast.Expression {
 	exp := &ast.CallExpression{Token: p.curToken, Function: function}
 	exp.Arguments = p.parseExpressionList(token.RPAREN)
+	exp.Rparen = p.curToken.Pos
 	return exp
 }
 
@@ -554,6 +1103,7 @@ func (p *Parser) parseIndexExpression(left ast.Expression) ast.Expression {
 	if !p.expectPeek(token.RBRACKET) {
 		return nil
 	}
+	exp.Rbracket = p.curToken.Pos
 
 	return exp
 }
@@ -612,6 +1162,7 @@ func (p *Parser) parseHashLiteral() ast.Expression {
 	if !p.expectPeek(token.RBRACE) {
 		return nil
 	}
+	hash.Rbrace = p.curToken.Pos
 
 	return hash
 }
@@ -42,6 +42,28 @@ func TestLetStatements(t *testing.T) {
 	}
 }
 
+func TestConstStatement(t *testing.T) {
+	l := lexer.New("const x = 5;")
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	stmt, ok := program.Statements[0].(*ast.LetStatement)
+	if !ok {
+		t.Fatalf("program.Statements[0] is not ast.LetStatement. got=%T",
+			program.Statements[0])
+	}
+	if !stmt.IsConst() {
+		t.Errorf("stmt.IsConst() is not true")
+	}
+	if stmt.String() != "const x = 5;" {
+		t.Errorf("stmt.String() wrong. got=%q", stmt.String())
+	}
+	if !testLiteralExpression(t, stmt.Value, 5) {
+		return
+	}
+}
+
 func TestReturnStatements(t *testing.T) {
 
 	tests := []struct {
@@ -172,6 +194,93 @@ func TestIntegerLiteralExpression(t *testing.T) {
 	}
 }
 
+func TestIntegerLiteralBase(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"0xFF", 255},
+		{"0o755", 493},
+		{"0b1010", 10},
+		{"1_000_000", 1000000},
+		{"9223372036854775807", 9223372036854775807},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		stmt := program.Statements[0].(*ast.ExpressionStatement)
+		literal, ok := stmt.Expression.(*ast.IntegerLiteral)
+		if !ok {
+			t.Fatalf("exp not *ast.IntegerLiteral. got=%T", stmt.Expression)
+		}
+		if literal.Value != tt.expected {
+			t.Errorf("literal.Value not %d. got=%d", tt.expected, literal.Value)
+		}
+	}
+}
+
+func TestIntegerLiteralErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"let x =\n  9223372036854775808;", "2:3: integer literal 9223372036854775808 overflows int64"},
+		{"0x1_0000_0000_0000_0000", "1:1: integer literal 0x1_0000_0000_0000_0000 overflows int64"},
+		{"0b102", `1:1: could not parse "0b102" as integer`},
+		{"1__000", `1:1: could not parse "1__000" as integer`},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		p.ParseProgram()
+
+		errors := p.Errors()
+		if len(errors) != 1 || errors[0] != tt.expected {
+			t.Errorf("wrong errors. expected=%q, got=%q", tt.expected, errors)
+		}
+	}
+}
+
+func TestFloatLiteralExpression(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected float64
+	}{
+		{"3.14", 3.14},
+		{"0.5", 0.5},
+		{"1e-9", 1e-9},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		stmt, ok := program.Statements[0].(*ast.ExpressionStatement)
+		if !ok {
+			t.Fatalf("program.Statements[0] is not ast.ExpressionStatement. got=%T",
+				program.Statements[0])
+		}
+
+		literal, ok := stmt.Expression.(*ast.FloatLiteral)
+		if !ok {
+			t.Fatalf("exp not *ast.FloatLiteral. got=%T", stmt.Expression)
+		}
+		if literal.Value != tt.expected {
+			t.Errorf("literal.Value not %g. got=%g", tt.expected, literal.Value)
+		}
+		if literal.TokenLiteral() != tt.input {
+			t.Errorf("literal.TokenLiteral not %s. got=%s", tt.input, literal.TokenLiteral())
+		}
+	}
+}
+
 func TestBooleanExpression(t *testing.T) {
 	booleanTests := []struct {
 		input        string
@@ -220,6 +329,7 @@ func TestParsingPrefixExpressions(t *testing.T) {
 		{"-15", "-", 15},
 		{"!true;", "!", true},
 		{"!false;", "!", false},
+		{"~5", "~", 5},
 	}
 
 	for _, tt := range prifxTests {
@@ -268,6 +378,17 @@ func TestParsingInfixExpressions(t *testing.T) {
 		{"5 < 5", 5, "<", 5},
 		{"5 == 5", 5, "==", 5},
 		{"5 != 5", 5, "!=", 5},
+		{"5 % 5", 5, "%", 5},
+		{"5 ** 5", 5, "**", 5},
+		{"5 & 5", 5, "&", 5},
+		{"5 | 5", 5, "|", 5},
+		{"5 ^ 5", 5, "^", 5},
+		{"5 << 5", 5, "<<", 5},
+		{"5 >> 5", 5, ">>", 5},
+		{"5 <= 5", 5, "<=", 5},
+		{"5 >= 5", 5, ">=", 5},
+		{"true && false", true, "&&", false},
+		{"true || false", true, "||", false},
 		{"true == true", true, "==", true},
 		{"false == false", false, "==", false},
 	}
@@ -392,6 +513,54 @@ func TestOperatorPrecedeceParsing(t *testing.T) {
 		}, {
 			"add(a * b[2], b[1], 2 * [1, 2][1])",
 			"add((a * (b[2])), (b[1]), (2 * ([1, 2][1])))",
+		}, {
+			"a % b * c",
+			"((a % b) * c)",
+		}, {
+			"a + b % c",
+			"(a + (b % c))",
+		}, {
+			"a ** b ** c",
+			"(a ** (b ** c))",
+		}, {
+			"-a ** b",
+			"(-(a ** b))",
+		}, {
+			"a * b ** c",
+			"(a * (b ** c))",
+		}, {
+			"a ** -b",
+			"(a ** (-b))",
+		}, {
+			"a | b ^ c & d",
+			"(a | (b ^ (c & d)))",
+		}, {
+			"a & b << c + d",
+			"(a & (b << (c + d)))",
+		}, {
+			"a << b >> c",
+			"((a << b) >> c)",
+		}, {
+			"a & b == c | d",
+			"((a & b) == (c | d))",
+		}, {
+			"~a & b",
+			"((~a) & b)",
+		}, {
+			"a <= b == b >= c",
+			"((a <= b) == (b >= c))",
+		}, {
+			"a || b && c",
+			"(a || (b && c))",
+		}, {
+			"a && b || c && d",
+			"((a && b) || (c && d))",
+		}, {
+			"a == b && c != d",
+			"((a == b) && (c != d))",
+		}, {
+			"!a || b",
+			"((!a) || b)",
 		},
 	}
 
@@ -561,6 +730,150 @@ func TestIfElseExpression(t *testing.T) {
 	}
 }
 
+func TestWhileStatement(t *testing.T) {
+	input := `while (x < 10) { x; break; };`
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	if len(program.Statements) != 1 {
+		t.Fatalf("program.Statements does not contain %d statements. got=%d\n",
+			1, len(program.Statements))
+	}
+
+	stmt, ok := program.Statements[0].(*ast.WhileStatement)
+	if !ok {
+		t.Fatalf("program.Statements[0] is not ast.WhileStatement. got=%T",
+			program.Statements[0])
+	}
+
+	if !testInfixExpression(t, stmt.Condition, "x", "<", 10) {
+		return
+	}
+
+	if len(stmt.Body.Statements) != 2 {
+		t.Fatalf("body is not 2 statements. got=%d\n", len(stmt.Body.Statements))
+	}
+
+	if _, ok := stmt.Body.Statements[1].(*ast.BreakStatement); !ok {
+		t.Fatalf("body.Statements[1] is not ast.BreakStatement. got=%T",
+			stmt.Body.Statements[1])
+	}
+}
+
+func TestForStatement(t *testing.T) {
+	tests := []struct {
+		input            string
+		expectedKey      string
+		expectedValue    string
+		expectedIterable string
+	}{
+		{"for (x in arr) { continue; }", "", "x", "arr"},
+		{"for (k, v in hash) { k; }", "k", "v", "hash"},
+		{"for (i in range(10)) { i }", "", "i", "range(10)"},
+		{"for (x in arr) { x };", "", "x", "arr"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		stmt, ok := program.Statements[0].(*ast.ForStatement)
+		if !ok {
+			t.Fatalf("program.Statements[0] is not ast.ForStatement. got=%T",
+				program.Statements[0])
+		}
+
+		if tt.expectedKey == "" && stmt.Key != nil {
+			t.Errorf("stmt.Key is not nil. got=%q", stmt.Key.String())
+		}
+		if tt.expectedKey != "" && !testIdentifier(t, stmt.Key, tt.expectedKey) {
+			return
+		}
+		if !testIdentifier(t, stmt.Value, tt.expectedValue) {
+			return
+		}
+		if stmt.Iterable.String() != tt.expectedIterable {
+			t.Errorf("stmt.Iterable is not %q. got=%q",
+				tt.expectedIterable, stmt.Iterable.String())
+		}
+	}
+}
+
+func TestLoopControlOutsideLoop(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"break;", "1:1: break is not in a loop"},
+		{"if (true) { continue; }", "1:13: continue is not in a loop"},
+		{"while (true) { fn() { break; } }", "1:23: break is not in a loop"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		p.ParseProgram()
+
+		errors := p.Errors()
+		if len(errors) != 1 || errors[0] != tt.expected {
+			t.Errorf("wrong errors. expected=%q, got=%q", tt.expected, errors)
+		}
+	}
+}
+
+func TestTryStatement(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"try { f() } catch (e) { g(e) }", "try f() catch (e) g(e)"},
+		{"try { f() } finally { g() }", "try f() finally g()"},
+		{"try { f() } catch (e) { 1 } finally { 2 };", "try f() catch (e) 1 finally 2"},
+		{"throw 1 + 2;", "throw (1 + 2);"},
+		{"throw {\"message\": \"x\"}", "throw {message:x};"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		if len(program.Statements) != 1 {
+			t.Fatalf("program.Statements does not contain 1 statement. got=%d",
+				len(program.Statements))
+		}
+		if program.String() != tt.expected {
+			t.Errorf("expected=%q, got=%q", tt.expected, program.String())
+		}
+	}
+
+	errorTests := []struct {
+		input    string
+		expected string
+	}{
+		{"try { 1 }", "1:1: try without catch or finally"},
+		{"try { 1 } catch { 2 }", "1:17: expected next token to be (, got { insted"},
+		{"try { 1 } catch (1) { 2 }", "1:18: expected next token to be IDENT, got INT insted"},
+	}
+
+	for _, tt := range errorTests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		p.ParseProgram()
+
+		errors := p.Errors()
+		if len(errors) == 0 || errors[0] != tt.expected {
+			t.Errorf("wrong errors. expected=%q, got=%q", tt.expected, errors)
+		}
+	}
+}
+
 func TestFunctionLiteral(t *testing.T) {
 	input := `fn(x, y) { x + y; }`
 
@@ -638,6 +951,173 @@ func TestFunctionParameterParsing(t *testing.T) {
 	}
 }
 
+func TestFunctionStatement(t *testing.T) {
+	input := "fn add(x, y) { x + y }"
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	if len(program.Statements) != 1 {
+		t.Fatalf("program.Statements does not contain %d statements. got=%d\n",
+			1, len(program.Statements))
+	}
+
+	stmt, ok := program.Statements[0].(*ast.FunctionStatement)
+	if !ok {
+		t.Fatalf("program.Statements[0] is not ast.FunctionStatement. got=%T",
+			program.Statements[0])
+	}
+
+	if stmt.Function.Name != "add" {
+		t.Errorf("function name is not 'add'. got=%q", stmt.Function.Name)
+	}
+	if len(stmt.Function.Parameters) != 2 {
+		t.Fatalf("function literal parameters wrong. want 2, got=%d\n",
+			len(stmt.Function.Parameters))
+	}
+	if stmt.String() != "fn add(x, y)(x + y)" {
+		t.Errorf("stmt.String() wrong. got=%q", stmt.String())
+	}
+
+	// 式の位置では名前付きの関数リテラルになる
+	l = lexer.New("let f = fn g() { 1 };")
+	p = New(l)
+	program = p.ParseProgram()
+	checkParserErrors(t, p)
+
+	let := program.Statements[0].(*ast.LetStatement)
+	lit, ok := let.Value.(*ast.FunctionLiteral)
+	if !ok {
+		t.Fatalf("let.Value is not ast.FunctionLiteral. got=%T", let.Value)
+	}
+	if lit.Name != "g" || lit.Inferred {
+		t.Errorf("function name is not explicit 'g'. got=%q (inferred=%t)", lit.Name, lit.Inferred)
+	}
+
+	// let で束縛した無名関数には束縛先の名前が付く (String には出さない)
+	l = lexer.New("let f = fn() { 1 };")
+	p = New(l)
+	program = p.ParseProgram()
+	checkParserErrors(t, p)
+
+	let = program.Statements[0].(*ast.LetStatement)
+	lit = let.Value.(*ast.FunctionLiteral)
+	if lit.Name != "f" || !lit.Inferred {
+		t.Errorf("function name is not inferred 'f'. got=%q (inferred=%t)", lit.Name, lit.Inferred)
+	}
+	if let.String() != "let f = fn()1;" {
+		t.Errorf("let.String() wrong. got=%q", let.String())
+	}
+}
+
+func TestTailCallMarking(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []string // 末尾位置にある呼び出し
+	}{
+		{"fn() { f(1) }", []string{"f(1)"}},
+		{"fn() { f(1); g(2) }", []string{"g(2)"}},
+		{"fn() { return f(1); g(2) }", []string{"f(1)", "g(2)"}},
+		{"fn() { f(1) + 1 }", []string{}},
+		{"fn() { let x = f(1); x }", []string{}},
+		{"fn() { if (a) { f(1) } else { g(2) } }", []string{"f(1)", "g(2)"}},
+		{"fn() { if (a) { f(1) }; g(2) }", []string{"g(2)"}},
+		{"fn() { if (a) { return f(1) }; g(2) }", []string{"f(1)", "g(2)"}},
+		{"fn() { while (a) { f(1); return g(2) } }", []string{"g(2)"}},
+		{"fn() { for (x in a) { f(x) } }", []string{}},
+		{"fn() { fn() { f(1) }; g(2) }", []string{"f(1)", "g(2)"}},
+		{"f(1)", []string{}},
+		{"return f(1);", []string{}},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		tails := []string{}
+		ast.Modify(program, func(node ast.Node) ast.Node {
+			if call, ok := node.(*ast.CallExpression); ok && call.Tail {
+				tails = append(tails, call.String())
+			}
+			return node
+		})
+
+		if fmt.Sprint(tails) != fmt.Sprint(tt.expected) {
+			t.Errorf("wrong tail calls for %q. expected=%v, got=%v",
+				tt.input, tt.expected, tails)
+		}
+	}
+}
+
+func TestReturnStatementWithoutSemicolon(t *testing.T) {
+	input := "fn() { return 1 }; let x = 2;"
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	if len(program.Statements) != 2 {
+		t.Fatalf("program.Statements does not contain %d statements. got=%d (%s)",
+			2, len(program.Statements), program.String())
+	}
+}
+
+func TestFunctionDefaultAndRestParameters(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"fn(a, b = 2) {}", "fn(a, b = 2)"},
+		{"fn(a = 1, b = a + 1) {}", "fn(a = 1, b = (a + 1))"},
+		{"fn(a, ...rest) {}", "fn(a, ...rest)"},
+		{"fn(...rest) {}", "fn(...rest)"},
+		{"fn(a, b = 2, ...rest) { a }", "fn(a, b = 2, ...rest)a"},
+		{"f(...arr)", "f(...arr)"},
+		{"f(1, ...[2, 3], 4)", "f(1, ...[2, 3], 4)"},
+		{"[1, ...arr]", "[1, ...arr]"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		actual := program.String()
+		if actual != tt.expected {
+			t.Errorf("expected=%q, got=%q", tt.expected, actual)
+		}
+	}
+}
+
+func TestFunctionParameterErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"fn(a = 1, b) {}", "1:11: parameter without default value follows default parameter: b"},
+		{"fn(...rest, a) {}", "1:13: rest parameter must be last: ...rest"},
+		{"fn(1) {}", "1:4: expected parameter name, got INT"},
+		{"macro(a = 1) {}", "1:7: macro parameters cannot have default values or rest parameters"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		p.ParseProgram()
+
+		errors := p.Errors()
+		if len(errors) == 0 || errors[0] != tt.expected {
+			t.Errorf("wrong errors. expected=%q, got=%q", tt.expected, errors)
+		}
+	}
+}
+
 func TestCallExpressionParsing(t *testing.T) {
 	input := "add(1, 2 * 3, 4 + 5);"
 
@@ -695,6 +1175,56 @@ func TestStringLiteralExpression(t *testing.T) {
 	}
 }
 
+func TestTemplateLiteral(t *testing.T) {
+	input := `"a${x + 1}b${ {"k": y}["k"] }c"`
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	stmt := program.Statements[0].(*ast.ExpressionStatement)
+	template, ok := stmt.Expression.(*ast.TemplateLiteral)
+	if !ok {
+		t.Fatalf("exp not *ast.TemplateLiteral. got=%T", stmt.Expression)
+	}
+
+	if len(template.Texts) != 3 || len(template.Values) != 2 {
+		t.Fatalf("wrong number of parts. texts=%q, values=%d",
+			template.Texts, len(template.Values))
+	}
+	testInfixExpression(t, template.Values[0], "x", "+", 1)
+
+	if template.String() != "a${(x + 1)}b${({k:y}[k])}c" {
+		t.Errorf("template.String() wrong. got=%q", template.String())
+	}
+	if end := template.End(); end.Offset != len(input) {
+		t.Errorf("template.End() wrong. got=%s", end)
+	}
+}
+
+func TestTemplateLiteralErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`"a${}b"`, "1:5: empty expression in string interpolation"},
+		{`"a${x y}"`, "1:7: expected } to close string interpolation, got IDENT"},
+		{`"a${x}b`, "1:6: illegal token: unterminated string literal"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		p.ParseProgram()
+
+		errors := p.Errors()
+		if len(errors) == 0 || errors[0] != tt.expected {
+			t.Errorf("wrong errors. expected=%q, got=%q", tt.expected, errors)
+		}
+	}
+}
+
 func TestParsingArrayLiteral(t *testing.T) {
 	input := "[1, 2 * 2, 3 + 3]"
 
@@ -922,6 +1452,92 @@ func TestClassLiteralParsing(t *testing.T) {
 		t.Fatalf("class.Body.Statements has not 0 statements. got=%d\n",
 			len(class.Body.Statements))
 	}
+
+	if class.Parent != nil {
+		t.Fatalf("class.Parent is not nil. got=%s", class.Parent)
+	}
+}
+
+func TestClassExtendsParsing(t *testing.T) {
+	input := `class Dog extends Animal { let constructor = fn(name) { super(name); super.init() } }`
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	stmt := program.Statements[0].(*ast.ExpressionStatement)
+	class, ok := stmt.Expression.(*ast.ClassLiteral)
+	if !ok {
+		t.Fatalf("stmt.Expression is not ast.ClassLiteral. got %T",
+			stmt.Expression)
+	}
+
+	if !testIdentifier(t, class.Name, "Dog") || !testIdentifier(t, class.Parent, "Animal") {
+		return
+	}
+
+	expected := "class Dog extends Animal let constructor = fn(name)super(name)(super.init)();"
+	if class.String() != expected {
+		t.Errorf("class.String() wrong.\nexpected=%q\ngot=%q", expected, class.String())
+	}
+}
+
+func TestStaticStatement(t *testing.T) {
+	input := `class C { static let n = 0; static fn make() { C() }; let x = 1; }`
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	stmt := program.Statements[0].(*ast.ExpressionStatement)
+	class := stmt.Expression.(*ast.ClassLiteral)
+	if len(class.Body.Statements) != 3 {
+		t.Fatalf("class.Body.Statements has not 3 statements. got=%d", len(class.Body.Statements))
+	}
+
+	static, ok := class.Body.Statements[0].(*ast.StaticStatement)
+	if !ok {
+		t.Fatalf("Statements[0] is not ast.StaticStatement. got=%T", class.Body.Statements[0])
+	}
+	if !testLetStatement(t, static.Statement, "n") {
+		return
+	}
+
+	static, ok = class.Body.Statements[1].(*ast.StaticStatement)
+	if !ok {
+		t.Fatalf("Statements[1] is not ast.StaticStatement. got=%T", class.Body.Statements[1])
+	}
+	if _, ok := static.Statement.(*ast.FunctionStatement); !ok {
+		t.Fatalf("static.Statement is not ast.FunctionStatement. got=%T", static.Statement)
+	}
+
+	if _, ok := class.Body.Statements[2].(*ast.LetStatement); !ok {
+		t.Fatalf("Statements[2] is not ast.LetStatement. got=%T", class.Body.Statements[2])
+	}
+}
+
+func TestStaticStatementErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"static let x = 1;", "1:1: static declaration outside of class body"},
+		{"class C { let f = fn() { static let x = 1; }; }", "1:26: static declaration outside of class body"},
+		{"class C { static 1; }", "1:18: expected let, const or fn declaration after static, got INT"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		p.ParseProgram()
+
+		errors := p.Errors()
+		if len(errors) == 0 || errors[0] != tt.expected {
+			t.Errorf("wrong errors. expected=%q, got=%q", tt.expected, errors)
+		}
+	}
 }
 
 func TestDotExpressionParsing(t *testing.T) {
@@ -989,6 +1605,34 @@ func TestParsingAssingmentExpression(t *testing.T) {
 	testLiteralExpression(t, exp.Right, 2)
 }
 
+func TestParsingAssignmentTargets(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"a = b = 1;", "(a=(b=1))"},
+		{"a += 1 + 2;", "(a+=(1 + 2))"},
+		{"a -= b * 2;", "(a-=(b * 2))"},
+		{"a *= 2;", "(a*=2)"},
+		{"a /= 2;", "(a/=2)"},
+		{"arr[0] = 1;", "((arr[0])=1)"},
+		{"h[\"k\"] += 1;", "((h[k])+=1)"},
+		{"this.a = 1;", "((this.a)=1)"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		actual := program.String()
+		if actual != tt.expected {
+			t.Errorf("expected=%q, got=%q", tt.expected, actual)
+		}
+	}
+}
+
 func TestParsingAssingmentExpressionDot(t *testing.T) {
 	input := "this.a = 2;"
 
@@ -1188,3 +1832,216 @@ func testBooleanLiteral(t *testing.T, exp ast.Expression, value bool) bool {
 
 	return true
 }
+
+func TestParserErrorPosition(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"let x 5;", "1:7: expected next token to be =, got INT insted"},
+		{"let x = 1;\nlet = 2;", "2:5: expected next token to be IDENT, got = insted"},
+		{"foo(1,\n  )", "2:3: no prefix parse function for ) found"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		p.ParseProgram()
+
+		errors := p.Errors()
+		if len(errors) == 0 {
+			t.Errorf("parser has no errors for %q", tt.input)
+			continue
+		}
+		if errors[0] != tt.expected {
+			t.Errorf("wrong error. expected=%q, got=%q", tt.expected, errors[0])
+		}
+	}
+}
+
+func TestNodePositions(t *testing.T) {
+	input := `let add = fn(x, y) {
+	x + y;
+};
+add(1, [2, 3][0]);`
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	tests := []struct {
+		node     ast.Node
+		expected string
+		end      string
+	}{
+		{program.Statements[0], "1:1", "3:2"},
+		{program.Statements[0].(*ast.LetStatement).Value, "1:11", "3:2"},
+		{program.Statements[1], "4:1", "4:18"},
+	}
+
+	for i, tt := range tests {
+		if tt.node.Pos().String() != tt.expected {
+			t.Errorf("tests[%d] - wrong pos. expected=%q, got=%q",
+				i, tt.expected, tt.node.Pos().String())
+		}
+		if tt.node.End().String() != tt.end {
+			t.Errorf("tests[%d] - wrong end. expected=%q, got=%q",
+				i, tt.end, tt.node.End().String())
+		}
+	}
+}
+
+func TestIllegalTokenError(t *testing.T) {
+	l := lexer.New(`let s = "abc;`)
+	p := New(l)
+	p.ParseProgram()
+
+	errors := p.Errors()
+	expected := "1:9: illegal token: unterminated string literal"
+	if len(errors) == 0 || errors[0] != expected {
+		t.Fatalf("wrong errors. expected=%q, got=%q", expected, errors)
+	}
+}
+
+func TestCommentAttachment(t *testing.T) {
+	input := `// adds two numbers
+let add = fn(x, y) {
+	/* the result */
+	x + y; // trailing
+};
+add(1, 2); /* call */
+// last
+`
+
+	l := lexer.New(input)
+	l.SetMode(lexer.ScanComments)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	if len(program.Statements) != 2 {
+		t.Fatalf("program.Statements does not contain 2 statements. got=%d",
+			len(program.Statements))
+	}
+
+	if len(program.Comments) != 5 {
+		t.Fatalf("program.Comments does not contain 5 comments. got=%d",
+			len(program.Comments))
+	}
+
+	let := program.Statements[0].(*ast.LetStatement)
+	if len(let.Comments) != 1 || let.Comments[0].String() != "// adds two numbers" {
+		t.Errorf("wrong comments on let statement. got=%v", let.Comments)
+	}
+
+	body := let.Value.(*ast.FunctionLiteral).Body
+	inner := body.Statements[0].(*ast.ExpressionStatement)
+	if len(inner.Comments) != 2 ||
+		inner.Comments[0].String() != "/* the result */" ||
+		inner.Comments[1].String() != "// trailing" {
+		t.Errorf("wrong comments on body statement. got=%v", inner.Comments)
+	}
+
+	call := program.Statements[1].(*ast.ExpressionStatement)
+	if len(call.Comments) != 1 || call.Comments[0].String() != "/* call */" {
+		t.Errorf("wrong comments on call statement. got=%v", call.Comments)
+	}
+}
+
+func TestLoopStatementComments(t *testing.T) {
+	input := `// count up
+while (true) {
+	// stop
+	break;
+}
+/* each */
+for (x in xs) {
+	// skip
+	continue;
+}
+`
+
+	l := lexer.New(input)
+	l.SetMode(lexer.ScanComments)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	if len(program.Statements) != 2 {
+		t.Fatalf("program.Statements does not contain 2 statements. got=%d",
+			len(program.Statements))
+	}
+
+	while := program.Statements[0].(*ast.WhileStatement)
+	if len(while.Comments) != 1 || while.Comments[0].String() != "// count up" {
+		t.Errorf("wrong comments on while statement. got=%v", while.Comments)
+	}
+	brk := while.Body.Statements[0].(*ast.BreakStatement)
+	if len(brk.Comments) != 1 || brk.Comments[0].String() != "// stop" {
+		t.Errorf("wrong comments on break statement. got=%v", brk.Comments)
+	}
+
+	loop := program.Statements[1].(*ast.ForStatement)
+	if len(loop.Comments) != 1 || loop.Comments[0].String() != "/* each */" {
+		t.Errorf("wrong comments on for statement. got=%v", loop.Comments)
+	}
+	cont := loop.Body.Statements[0].(*ast.ContinueStatement)
+	if len(cont.Comments) != 1 || cont.Comments[0].String() != "// skip" {
+		t.Errorf("wrong comments on continue statement. got=%v", cont.Comments)
+	}
+}
+
+func TestTryStatementComments(t *testing.T) {
+	input := `// guard
+try {
+	/* fail */
+	throw 1;
+} catch (e) {
+}
+`
+
+	l := lexer.New(input)
+	l.SetMode(lexer.ScanComments)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	if len(program.Statements) != 1 {
+		t.Fatalf("program.Statements does not contain 1 statement. got=%d",
+			len(program.Statements))
+	}
+
+	try := program.Statements[0].(*ast.TryStatement)
+	if len(try.Comments) != 1 || try.Comments[0].String() != "// guard" {
+		t.Errorf("wrong comments on try statement. got=%v", try.Comments)
+	}
+	throw := try.Body.Statements[0].(*ast.ThrowStatement)
+	if len(throw.Comments) != 1 || throw.Comments[0].String() != "/* fail */" {
+		t.Errorf("wrong comments on throw statement. got=%v", throw.Comments)
+	}
+}
+
+func TestStaticStatementComments(t *testing.T) {
+	input := `class C {
+	// instances created
+	static let n = 0; // counter
+}`
+
+	l := lexer.New(input)
+	l.SetMode(lexer.ScanComments)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	class := program.Statements[0].(*ast.ExpressionStatement).Expression.(*ast.ClassLiteral)
+	static := class.Body.Statements[0].(*ast.StaticStatement)
+	if len(static.Comments) != 1 || static.Comments[0].String() != "// instances created" {
+		t.Errorf("wrong comments on static statement. got=%v", static.Comments)
+	}
+
+	let := static.Statement.(*ast.LetStatement)
+	if len(let.Comments) != 1 || let.Comments[0].String() != "// counter" {
+		t.Errorf("wrong comments on static let statement. got=%v", let.Comments)
+	}
+}
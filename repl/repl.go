@@ -38,8 +38,15 @@ func Start(in io.Reader, out io.Writer) {
 			continue
 		}
 
-		evaluator.DefineMacros(program, macroEnv)
-		expanded := evaluator.ExpandMacros(program, macroEnv)
+		if err := evaluator.DefineMacrosErr(program, macroEnv); err != nil {
+			printError(out, err)
+			continue
+		}
+		expanded, err := evaluator.ExpandMacrosErr(program, macroEnv)
+		if err != nil {
+			printError(out, err)
+			continue
+		}
 
 		evaluated := evaluator.Eval(expanded, env)
 		if evaluated != nil {
@@ -63,6 +70,16 @@ const AA = `
 　 　 　 　 　 　：/　　：⊂ノ|：
 `
 
+// マクロの展開で起きたエラーを、評価のエラーと同じ形式で表示する
+func printError(out io.Writer, err error) {
+	if e, ok := err.(*object.Error); ok {
+		io.WriteString(out, e.Inspect())
+	} else {
+		io.WriteString(out, err.Error())
+	}
+	io.WriteString(out, "\n")
+}
+
 func printParserErrors(out io.Writer, errors []string) {
 	io.WriteString(out, AA)
 	io.WriteString(out, "Woops! we ran int some monkey buisness here\n")
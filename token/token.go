@@ -1,5 +1,7 @@
 package token
 
+import "fmt"
+
 /// TokenType represent token type
 type TokenType string
 
@@ -7,18 +9,55 @@ type TokenType string
 type Token struct {
 	Type    TokenType
 	Literal string
+	Pos     Position // position of the first character of the token
+	End     Position // position immediately after the token
+}
+
+// Position : location in the source, Line and Column are 1-based
+type Position struct {
+	Filename string
+	Offset   int // byte offset, starting at 0
+	Line     int
+	Column   int
+}
+
+// IsValid : report whether the position has been set
+func (p Position) IsValid() bool {
+	return p.Line > 0
+}
+
+// String : "file:line:column", "line:column" or "-" for invalid position
+func (p Position) String() string {
+	if !p.IsValid() {
+		if p.Filename != "" {
+			return p.Filename
+		}
+		return "-"
+	}
+	s := fmt.Sprintf("%d:%d", p.Line, p.Column)
+	if p.Filename != "" {
+		s = p.Filename + ":" + s
+	}
+	return s
 }
 
 // token
 const (
-	ILLEGAL = "ILLEGAL"
+	ILLEGAL = "ILLEGAL" // Literal holds the illegal character or a lexical error message
 	EOF     = "EOF"
+	COMMENT = "COMMENT" // only emitted when the lexer is asked to scan comments
 
 	// identifier + Literal
 	IDENT  = "IDENT"
 	INT    = "INT"
+	FLOAT  = "FLOAT"
 	STRING = "STRING"
 
+	// string interpolation "a${x}b${y}c" : TEMPLATE_HEAD("a") x TEMPLATE_MIDDLE("b") y TEMPLATE_TAIL("c")
+	TEMPLATE_HEAD   = "TEMPLATE_HEAD"
+	TEMPLATE_MIDDLE = "TEMPLATE_MIDDLE"
+	TEMPLATE_TAIL   = "TEMPLATE_TAIL"
+
 	// operator
 	ASSIGN   = "="
 	PLUS     = "+"
@@ -26,9 +65,28 @@ const (
 	BANG     = "!"
 	ASTERISK = "*"
 	SLASH    = "/"
+	PERCENT  = "%"
+	POWER    = "**"
+
+	PLUS_ASSIGN     = "+="
+	MINUS_ASSIGN    = "-="
+	ASTERISK_ASSIGN = "*="
+	SLASH_ASSIGN    = "/="
+
+	AMPERSAND = "&"
+	PIPE      = "|"
+	CARET     = "^"
+	TILDE     = "~"
+	SHL       = "<<"
+	SHR       = ">>"
 
-	LT = "<"
-	GT = ">"
+	LT   = "<"
+	GT   = ">"
+	LTEQ = "<="
+	GTEQ = ">="
+
+	AND = "&&"
+	OR  = "||"
 
 	EQ    = "=="
 	NOTEQ = "!="
@@ -37,6 +95,7 @@ const (
 	COMMA     = ","
 	SEMICOLON = ";"
 	COLON     = ":"
+	ELLIPSIS  = "..."
 
 	LPAREN   = "("
 	RPAREN   = ")"
@@ -48,15 +107,30 @@ const (
 	// keyword
 	FUNCTION = "FUNCTION"
 	LET      = "LET"
+	CONST    = "CONST"
 	TRUE     = "TRUE"
 	FALSE    = "FALSE"
 	IF       = "IF"
 	ELSE     = "ELSE"
 	RETURN   = "RETURN"
 
-	CLASS = "CLASS"
-	THIS  = "THIS"
-	DOT   = "."
+	CLASS   = "CLASS"
+	THIS    = "THIS"
+	DOT     = "."
+	EXTENDS = "EXTENDS"
+	SUPER   = "SUPER"
+	STATIC  = "STATIC"
+
+	WHILE    = "WHILE"
+	FOR      = "FOR"
+	IN       = "IN"
+	BREAK    = "BREAK"
+	CONTINUE = "CONTINUE"
+
+	TRY     = "TRY"
+	CATCH   = "CATCH"
+	FINALLY = "FINALLY"
+	THROW   = "THROW"
 
 	// macro
 	MACRO = "MACRO"
@@ -65,6 +139,7 @@ const (
 var keywords = map[string]TokenType{
 	"fn":     FUNCTION,
 	"let":    LET,
+	"const":  CONST,
 	"true":   TRUE,
 	"false":  FALSE,
 	"if":     IF,
@@ -73,6 +148,21 @@ var keywords = map[string]TokenType{
 	"macro":  MACRO,
 	"class":  CLASS,
 	"this":   THIS,
+
+	"extends": EXTENDS,
+	"super":   SUPER,
+	"static":  STATIC,
+
+	"while":    WHILE,
+	"for":      FOR,
+	"in":       IN,
+	"break":    BREAK,
+	"continue": CONTINUE,
+
+	"try":     TRY,
+	"catch":   CATCH,
+	"finally": FINALLY,
+	"throw":   THROW,
 }
 
 // LookupIdent : check ident is keyword or identifier